@@ -7,31 +7,26 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/Yashh56/go-peerfs/pkg/peerfs"
 	"github.com/spf13/cobra"
 )
 
 var benchmarkCmd = &cobra.Command{
 	Use:   "benchmark [file_hash] [peer_id...]",
 	Short: "Runa a download benchmark for a specific file",
-	Long:  `This command Triggers a download on the running daemon and logs the performance (time and speed) to benchmarks.txt`,
+	Long:  `This command Triggers a download on the running daemon and logs the performance (time and speed) to the configured benchmark log file`,
 	Args:  cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		fileHash := args[0]
 		peerStrings := args[1:]
 
-		meta, err := getFileMeta(fileHash)
+		meta, err := getFileMeta(fileHash, peerStrings)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			return
 		}
 
-		type DownloadRequest struct {
-			Meta      file.FileMeta `json:"meta"`
-			Providers []string      `json:"providers"`
-		}
-
-		payload := DownloadRequest{
+		payload := peerfs.DownloadRequest{
 			Meta:      meta,
 			Providers: peerStrings,
 		}
@@ -42,7 +37,7 @@ var benchmarkCmd = &cobra.Command{
 		}
 		fmt.Printf("Requesting benchmark for file '%s'...\n", meta.Name)
 
-		resp, err := http.Post("http://localhost:8000/benchmark/transfer", "application/json", bytes.NewBuffer(payloadBytes))
+		resp, err := http.Post(apiURL("/benchmark/transfer"), "application/json", bytes.NewBuffer(payloadBytes))
 
 		if err != nil {
 			fmt.Println("Error: Could not connect to the go-peerfs daemon.")
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var forceInit bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the node configuration file.",
+	// The subcommands report config errors themselves instead of failing
+	// in the root pre-run.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Write a default config file to the data directory.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path := config.Path(dataDir)
+		if _, err := os.Stat(path); err == nil && !forceInit {
+			fmt.Printf("Error: %s already exists, use --force to overwrite it.\n", path)
+			return
+		}
+		if err := config.Default(dataDir).Save(); err != nil {
+			fmt.Printf("Error writing config: %v\n", err)
+			return
+		}
+		fmt.Printf("Config written to %s\n", path)
+	},
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration (file and environment).",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := config.Load(dataDir)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		out, err := yaml.Marshal(c)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("# data dir: %s\n%s", c.DataDir, out)
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration for errors.",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := config.Load(dataDir)
+		if err == nil {
+			err = c.Validate()
+		}
+		if err != nil {
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+			return fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		fmt.Println("Configuration is valid.")
+		return nil
+	},
+}
+
+func init() {
+	configInitCmd.Flags().BoolVarP(&forceInit, "force", "f", false, "Overwrite an existing config file")
+	configCmd.AddCommand(configInitCmd, configShowCmd, configValidateCmd)
+	rootCmd.AddCommand(configCmd)
+}
@@ -6,61 +6,109 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 
+	"github.com/Yashh56/go-peerfs/pkg/download"
 	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/Yashh56/go-peerfs/pkg/peerfs"
 	"github.com/spf13/cobra"
 )
 
+var (
+	downloadRecursive bool
+	downloadDetach    bool
+	downloadPriority  string
+)
+
 var downloadCmd = &cobra.Command{
 	Use:   "download [file_hash] [peer_id...]",
 	Short: "Download a file from one or more peers.",
-	Args:  cobra.MinimumNArgs(2),
+	Long: `Download a file from one or more peers. Without peer IDs the providers
+of the file are looked up in the DHT.
+
+With --recursive the hash is that of a directory, as listed by search, and
+the whole directory is recreated under the download directory.
+
+The download runs as a job of the daemon, so it carries on if this command
+is interrupted; see 'go-peerfs jobs'. Its progress is shown until it ends,
+or with --detach the command returns as soon as the job is queued.
+
+--priority (low, normal or high) decides which queued download starts
+first and how running downloads share chunk requests. Priorities are
+strict: a lower priority download only gets the requests that higher
+priority ones cannot use, so it may wait for as long as they run.`,
+	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		fileHash := args[0]
 		peerStrings := args[1:]
-
-		meta, err := getFileMeta(fileHash)
+		priority, err := download.ParsePriority(downloadPriority)
 		if err != nil {
 			fmt.Printf("Error: %v\n", err)
 			return
 		}
 
-		type DownloadRequest struct {
-			Meta      file.FileMeta `json:"meta"`
-			Providers []string      `json:"providers"`
-		}
-		payload := DownloadRequest{
-			Meta:      meta,
+		payload := peerfs.DownloadRequest{
 			Providers: peerStrings,
+			Priority:  priority,
 		}
-		payloadBytes, err := json.Marshal(payload)
-		if err != nil {
-			fmt.Printf("Error creating request payload: %v\n", err)
-			return
-		}
-
-		fmt.Printf("Sending download request to daemon for file '%s'...\n", meta.Name)
-		resp, err := http.Post("http://localhost:8000/download", "application/json", bytes.NewBuffer(payloadBytes))
-		if err != nil {
-			fmt.Println("Error: Could not connect to the go-peerfs daemon.")
-			fmt.Println("Please make sure the daemon is running with 'go-peerfs start'.")
-			return
+		if downloadRecursive {
+			payload.Collection = fileHash
+		} else {
+			meta, err := getFileMeta(fileHash, peerStrings)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			payload.Meta = meta
 		}
-		defer resp.Body.Close()
-
-		body, _ := io.ReadAll(resp.Body)
-		if resp.StatusCode != http.StatusOK {
-			fmt.Printf("Error from daemon: %s - %s\n", resp.Status, string(body))
+		if downloadRecursive {
+			fmt.Printf("Sending download request to daemon for directory %s...\n", fileHash)
 		} else {
-			fmt.Println(string(body))
+			fmt.Printf("Sending download request to daemon for file '%s'...\n", payload.Meta.Name)
 		}
+		queueDownload("/downloads", payload, downloadDetach)
 	},
 }
 
-func getFileMeta(hash string) (file.FileMeta, error) {
+// queueDownload sends a request for a download job to the daemon at path
+// and, unless detach is set, shows its progress until it ends.
+func queueDownload(path string, payload any, detach bool) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		fmt.Printf("Error creating request payload: %v\n", err)
+		return
+	}
+	resp, err := http.Post(apiURL(path), "application/json", bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		fmt.Println("Error: Could not connect to the go-peerfs daemon.")
+		fmt.Println("Please make sure the daemon is running with 'go-peerfs start'.")
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusAccepted {
+		fmt.Printf("Error from daemon: %s - %s\n", resp.Status, string(body))
+		return
+	}
+	var job download.Job
+	if err := json.Unmarshal(body, &job); err != nil {
+		fmt.Printf("Error parsing job: %v\n", err)
+		return
+	}
+	fmt.Printf("Queued as job %s.\n", job.ID)
+	if !detach {
+		watchJob(job.ID)
+	}
+}
+
+// getFileMeta asks the daemon for a file's metadata, which it looks up on
+// peers if the file is not in its own index.
+func getFileMeta(hash string, peers []string) (file.FileMeta, error) {
 	var meta file.FileMeta
 	fmt.Println(hash)
-	resp, err := http.Get("http://localhost:8000/fileMeta?hash=" + hash)
+	query := url.Values{"hash": {hash}, "peer": peers}
+	resp, err := http.Get(apiURL("/fileMeta?" + query.Encode()))
 	if err != nil {
 		return meta, fmt.Errorf("could not connect to the go-peerfs daemon")
 	}
@@ -76,5 +124,8 @@ func getFileMeta(hash string) (file.FileMeta, error) {
 }
 
 func init() {
+	downloadCmd.Flags().BoolVarP(&downloadDetach, "detach", "d", false, "Queue the download and return without waiting for it")
+	downloadCmd.Flags().StringVarP(&downloadPriority, "priority", "p", "normal", "Job priority: low, normal or high (higher priorities run first)")
+	downloadCmd.Flags().BoolVarP(&downloadRecursive, "recursive", "r", false, "Download a directory by its collection hash")
 	rootCmd.AddCommand(downloadCmd)
 }
@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/spf13/cobra"
+)
+
+var idCmd = &cobra.Command{
+	Use:   "id",
+	Short: "Print the peer ID of this node.",
+	Long:  `Prints the peer ID derived from the identity key in the data directory, generating the key if it does not exist yet.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		priv, err := p2p.LoadOrCreateIdentity(dataDir)
+		if err != nil {
+			fmt.Printf("Error loading identity: %v\n", err)
+			return
+		}
+		id, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			fmt.Printf("Error deriving peer ID: %v\n", err)
+			return
+		}
+		fmt.Println(id)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(idCmd)
+}
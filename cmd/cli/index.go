@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Yashh56/go-peerfs/pkg/peerfs"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rebuildIndex bool
+	indexDryRun  bool
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Rescan the shared directory on the running daemon.",
+	Long: `Asks the daemon to rescan its shared directory. Only new or changed files are hashed unless --rebuild is given, which discards the stored index and hashes everything again.
+
+With --dry-run nothing is hashed and no daemon is needed: the configured shares are walked with the current ignore rules and every file that would be shared is listed.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if indexDryRun {
+			listSharedFiles()
+			return
+		}
+
+		url := apiURL("/index")
+		if rebuildIndex {
+			url += "?rebuild=true"
+		}
+
+		resp, err := http.Post(url, "", nil)
+		printDaemonResponse(resp, err)
+	},
+}
+
+// listSharedFiles prints the files each configured share would index.
+func listSharedFiles() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SHARE\tPATH\tSIZE")
+	count := 0
+	for _, sc := range cfg.Shares {
+		err := peerfs.FileShare(cfg, sc).Walk(func(path, rel string, info os.FileInfo) error {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", sc.Name, rel, info.Size())
+			count++
+			return nil
+		})
+		if err != nil {
+			w.Flush()
+			fmt.Printf("Error walking share %s: %v\n", sc.Name, err)
+			os.Exit(1)
+		}
+	}
+	w.Flush()
+	fmt.Printf("%d files would be shared.\n", count)
+}
+
+func init() {
+	indexCmd.Flags().BoolVar(&rebuildIndex, "rebuild", false, "Discard the stored index and re-hash every file")
+	indexCmd.Flags().BoolVar(&indexDryRun, "dry-run", false, "List the files that would be shared without contacting the daemon")
+	rootCmd.AddCommand(indexCmd)
+}
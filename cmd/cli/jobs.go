@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Yashh56/go-peerfs/pkg/download"
+	"github.com/Yashh56/go-peerfs/pkg/peerfs"
+	"github.com/spf13/cobra"
+)
+
+var jobsCmd = &cobra.Command{
+	Use:   "jobs",
+	Short: "Manage the downloads queued in the running daemon.",
+}
+
+var jobsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List download jobs.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		resp, err := http.Get(apiURL("/downloads"))
+		if err != nil {
+			fmt.Println("Error: Could not connect to the go-peerfs daemon.")
+			fmt.Println("Please make sure the daemon is running with 'go-peerfs start'.")
+			return
+		}
+		defer resp.Body.Close()
+
+		var jobs []download.Job
+		if err := json.NewDecoder(resp.Body).Decode(&jobs); err != nil {
+			fmt.Printf("Error parsing job list: %v\n", err)
+			return
+		}
+
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(w, "ID\tSTATE\tPRIORITY\tNAME\tDETAILS")
+		fmt.Fprintln(w, "--\t-----\t--------\t----\t-------")
+		for _, job := range jobs {
+			name := job.Meta.Name
+			if job.Collection != "" {
+				name = job.Collection + "/"
+			}
+			details := job.SavedTo
+			if job.Error != "" {
+				details = job.Error
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", job.ID, job.State, job.Priority, name, details)
+		}
+		w.Flush()
+	},
+}
+
+var jobsPriorityCmd = &cobra.Command{
+	Use:   "priority [job_id] [low|normal|high]",
+	Short: "Change the priority of a download, even while it runs.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		priority, err := download.ParsePriority(args[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		payloadBytes, err := json.Marshal(peerfs.PriorityRequest{Priority: &priority})
+		if err != nil {
+			fmt.Printf("Error creating request payload: %v\n", err)
+			return
+		}
+		resp, err := http.Post(apiURL("/downloads/"+args[0]+"/priority"), "application/json", bytes.NewBuffer(payloadBytes))
+		printDaemonResponse(resp, err)
+	},
+}
+
+// jobAction returns a command that sends method to /downloads/<id><suffix>.
+func jobAction(use, short, method, suffix string) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " [job_id]",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req, err := http.NewRequest(method, apiURL("/downloads/"+args[0]+suffix), nil)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+			resp, err := http.DefaultClient.Do(req)
+			printDaemonResponse(resp, err)
+		},
+	}
+}
+
+func init() {
+	jobsCmd.AddCommand(
+		jobsListCmd,
+		jobAction("pause", "Pause a download, keeping what it has fetched.", http.MethodPost, "/pause"),
+		jobAction("resume", "Resume a paused or failed download.", http.MethodPost, "/resume"),
+		jobsPriorityCmd,
+		jobAction("cancel", "Cancel a download and remove it from the queue.", http.MethodDelete, ""),
+	)
+	rootCmd.AddCommand(jobsCmd)
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/spf13/cobra"
+)
+
+var forceImport bool
+
+var keyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the node identity key.",
+}
+
+var keyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the node identity with a freshly generated key.",
+	Long:  `Generates a new identity key. The previous key is kept as identity.key.old in the data directory. A running daemon keeps its old peer ID until it is restarted.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		priv, err := p2p.RotateIdentity(dataDir)
+		if err != nil {
+			fmt.Printf("Error rotating identity: %v\n", err)
+			return
+		}
+		id, _ := peer.IDFromPrivateKey(priv)
+		fmt.Printf("New peer ID: %s\n", id)
+	},
+}
+
+var keyExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the node identity key.",
+	Long:  `Writes the identity key as a base64 string to the given file, or to stdout if no file is given. Anyone holding the exported key can impersonate this node.`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		priv, err := p2p.LoadIdentity(dataDir)
+		if err != nil {
+			fmt.Printf("Error loading identity: %v\n", err)
+			return
+		}
+		encoded, err := p2p.ExportIdentity(priv)
+		if err != nil {
+			fmt.Printf("Error exporting identity: %v\n", err)
+			return
+		}
+
+		if len(args) == 0 {
+			fmt.Println(encoded)
+			return
+		}
+		if err := os.WriteFile(args[0], []byte(encoded+"\n"), 0600); err != nil {
+			fmt.Printf("Error writing %s: %v\n", args[0], err)
+			return
+		}
+		fmt.Printf("Identity exported to %s\n", args[0])
+	},
+}
+
+var keyImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Import a previously exported identity key.",
+	Long:  `Reads an exported identity key from the given file, or from stdin when the file is '-', and installs it as this node's identity.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var data []byte
+		var err error
+		if args[0] == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(args[0])
+		}
+		if err != nil {
+			fmt.Printf("Error reading key: %v\n", err)
+			return
+		}
+
+		priv, err := p2p.ImportIdentity(string(data))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		if _, err := os.Stat(p2p.IdentityPath(dataDir)); err == nil && !forceImport {
+			fmt.Println("Error: an identity already exists in the data directory, use --force to replace it.")
+			return
+		}
+		if err := p2p.SaveIdentity(dataDir, priv); err != nil {
+			fmt.Printf("Error saving identity: %v\n", err)
+			return
+		}
+		id, _ := peer.IDFromPrivateKey(priv)
+		fmt.Printf("Imported identity for peer ID: %s\n", id)
+	},
+}
+
+func init() {
+	keyImportCmd.Flags().BoolVarP(&forceImport, "force", "f", false, "Replace an existing identity")
+	keyCmd.AddCommand(keyRotateCmd, keyExportCmd, keyImportCmd)
+	rootCmd.AddCommand(keyCmd)
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/Yashh56/go-peerfs/pkg/download"
+	"github.com/Yashh56/go-peerfs/pkg/link"
+	"github.com/Yashh56/go-peerfs/pkg/peerfs"
+	"github.com/spf13/cobra"
+)
+
+var shareLinkCmd = &cobra.Command{
+	Use:   "share-link [path|hash]",
+	Short: "Print a peerfs:// link to a shared file or directory.",
+	Long:  `Prints a peerfs:// link to a file or directory shared by the running daemon. The link carries the hash, name, size and Merkle root along with this node's addresses, so it is all another node needs to download it with 'go-peerfs get'.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		target := args[0]
+		if _, err := os.Stat(target); err == nil {
+			if target, err = filepath.Abs(target); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return
+			}
+		}
+
+		resp, err := http.Get(apiURL("/link?target=" + url.QueryEscape(target)))
+		if err != nil {
+			fmt.Println("Error: Could not connect to the go-peerfs daemon.")
+			fmt.Println("Please make sure the daemon is running with 'go-peerfs start'.")
+			return
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			printDaemonResponse(resp, nil)
+			return
+		}
+		var res peerfs.LinkResponse
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			fmt.Printf("Error parsing daemon response: %v\n", err)
+			return
+		}
+		fmt.Println(res.URI)
+	},
+}
+
+var (
+	getDetach   bool
+	getPriority string
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get [peerfs://...]",
+	Short: "Download the file or directory a peerfs:// link points to.",
+	Long: `Download the file or directory a peerfs:// link points to. Like
+'go-peerfs download', the download runs as a job of the daemon and its
+progress is shown until it ends, unless --detach is given.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		l, err := link.Parse(args[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		priority, err := download.ParsePriority(getPriority)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		fmt.Printf("Sending download request to daemon for '%s'...\n", l.Meta().Name)
+		queueDownload("/get", peerfs.GetRequest{URI: args[0], Priority: priority}, getDetach)
+	},
+}
+
+func init() {
+	getCmd.Flags().BoolVarP(&getDetach, "detach", "d", false, "Queue the download and return without waiting for it")
+	getCmd.Flags().StringVarP(&getPriority, "priority", "p", "normal", "Job priority: low, normal or high (higher priorities run first)")
+	rootCmd.AddCommand(shareLinkCmd)
+	rootCmd.AddCommand(getCmd)
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/download"
+)
+
+// watchJob follows a download job over the daemon's event stream, drawing
+// a progress bar until the job finishes.
+func watchJob(id string) {
+	resp, err := http.Get(apiURL("/events?type=download."))
+	if err != nil {
+		fmt.Println("Error: Could not connect to the go-peerfs daemon.")
+		return
+	}
+	defer resp.Body.Close()
+
+	// The job may have ended before the stream was opened.
+	if job, err := getJob(id); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	} else if jobEnded(job) {
+		printJobResult(job)
+		return
+	}
+
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1<<20)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// If the stream goes quiet, ask for the job directly, so a dropped
+	// event cannot leave the command waiting forever.
+	ticker := time.NewTicker(jobPollInterval)
+	defer ticker.Stop()
+	idle := false
+	for {
+		var line string
+		select {
+		case l, ok := <-lines:
+			if !ok {
+				fmt.Println("\nLost the connection to the daemon; the download carries on. See 'go-peerfs jobs list'.")
+				return
+			}
+			line, idle = l, false
+		case <-ticker.C:
+			if idle {
+				job, err := getJob(id)
+				if err != nil {
+					fmt.Printf("\nError: %v\n", err)
+					return
+				}
+				if jobEnded(job) {
+					fmt.Println()
+					printJobResult(job)
+					return
+				}
+			}
+			idle = true
+			continue
+		}
+
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+		var ev struct {
+			Type string          `json:"type"`
+			Data json.RawMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(data), &ev); err != nil {
+			continue
+		}
+		switch ev.Type {
+		case "download.progress":
+			var p download.Progress
+			if err := json.Unmarshal(ev.Data, &p); err == nil && p.Job == id {
+				drawProgress(p)
+			}
+		case "download.job":
+			var job download.Job
+			if err := json.Unmarshal(ev.Data, &job); err == nil && job.ID == id && jobEnded(job) {
+				fmt.Println()
+				printJobResult(job)
+				return
+			}
+		}
+	}
+}
+
+// jobPollInterval is how long the event stream may stay quiet before
+// watchJob asks the daemon for the job.
+const jobPollInterval = 5 * time.Second
+
+// jobEnded reports whether watching job can stop.
+func jobEnded(job download.Job) bool {
+	return job.Finished() || job.State == download.JobCanceled
+}
+
+func getJob(id string) (download.Job, error) {
+	var job download.Job
+	resp, err := http.Get(apiURL("/downloads/" + id))
+	if err != nil {
+		return job, fmt.Errorf("could not connect to the go-peerfs daemon")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return job, fmt.Errorf("daemon returned an error: %s", resp.Status)
+	}
+	return job, json.NewDecoder(resp.Body).Decode(&job)
+}
+
+func printJobResult(job download.Job) {
+	switch job.State {
+	case download.JobDone:
+		fmt.Printf("✅ Download successful! Saved to %s\n", job.SavedTo)
+	case download.JobFailed:
+		fmt.Printf("Download failed: %s\n", job.Error)
+	case download.JobPaused:
+		fmt.Printf("Download paused; resume it with 'go-peerfs jobs resume %s'.\n", job.ID)
+	case download.JobCanceled:
+		fmt.Println("Download canceled.")
+	}
+}
+
+const progressBarWidth = 30
+
+// drawProgress redraws the progress line of a download in place.
+func drawProgress(p download.Progress) {
+	frac := 1.0
+	if p.Size > 0 {
+		frac = float64(p.Done) / float64(p.Size)
+	}
+	filled := int(frac * progressBarWidth)
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	eta := "--"
+	if p.ETA > 0 {
+		eta = p.ETA.Round(time.Second).String()
+	}
+	fmt.Printf("\r📥 %s %s %3.0f%% | %s/%s | %s/s | ETA %s | %d peers\033[K",
+		p.Name, bar, frac*100, formatBytes(p.Done), formatBytes(p.Size), formatBytes(int64(p.Rate)), eta, len(p.Providers))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
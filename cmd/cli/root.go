@@ -4,13 +4,24 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/Yashh56/go-peerfs/pkg/config"
 	"github.com/spf13/cobra"
 )
 
+var (
+	dataDir string
+	cfg     *config.Config
+)
+
 var rootCmd = &cobra.Command{
 	Use:   "go-peerfs",
 	Short: "A P2P File sharing System in Go.",
 	Long:  `go-peerfs is a decentralized file sharing application built with libp2p`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		cfg, err = config.Load(dataDir)
+		return err
+	},
 }
 
 func Execute() {
@@ -19,3 +30,15 @@ func Execute() {
 		os.Exit(1)
 	}
 }
+
+func apiURL(path string) string {
+	return fmt.Sprintf("http://localhost:%d%s", cfg.API.Port, path)
+}
+
+func init() {
+	defaultDataDir := ".peerfs"
+	if dir, ok := os.LookupEnv(config.EnvPrefix + "DATA_DIR"); ok {
+		defaultDataDir = dir
+	}
+	rootCmd.PersistentFlags().StringVar(&dataDir, "data-dir", defaultDataDir, "Directory holding the config file, node identity and state (env PEERFS_DATA_DIR)")
+}
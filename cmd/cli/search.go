@@ -8,16 +8,10 @@ import (
 	"os"
 	"text/tabwriter"
 
+	"github.com/Yashh56/go-peerfs/pkg/peerfs"
 	"github.com/spf13/cobra"
 )
 
-type SearchResult struct {
-	Name     string `json:"name"`
-	Size     int64  `json:"size"`
-	FileHash string `json:"file_hash"`
-	PeerID   string `json:"peer_id"`
-}
-
 var searchCmd = &cobra.Command{
 	Use:   "search [query]",
 	Short: "Search for files on the network",
@@ -25,7 +19,7 @@ var searchCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		query := args[0]
 		fmt.Println(query)
-		resp, err := http.Get("http://localhost:8000/search?q=" + query)
+		resp, err := http.Get(apiURL("/search?q=" + query))
 		if err != nil {
 			fmt.Println("Error: Could not connect to the go-peerfs daemon.")
 			fmt.Println("Please make sure the daemon is running with 'go-peerfs start'.")
@@ -38,7 +32,7 @@ var searchCmd = &cobra.Command{
 			fmt.Printf("Error Reading response Body: %v\n", err)
 			return
 		}
-		var results []SearchResult
+		var results []peerfs.SearchResult
 
 		if err := json.Unmarshal(body, &results); err != nil {
 			fmt.Printf("Error parsing Search results :%v\n", err)
@@ -54,7 +48,11 @@ var searchCmd = &cobra.Command{
 		fmt.Fprintln(w, "NAME\tSIZE (Bytes)\tHASH\tPEER ID")
 		fmt.Fprintln(w, "----\t------------\t----\t-------")
 		for _, res := range results {
-			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", res.Name, res.Size, res.FileHash, res.PeerID)
+			name := res.Name
+			if res.IsDir {
+				name += "/"
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", name, res.Size, res.FileHash, res.PeerID)
 		}
 		w.Flush()
 	},
@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/spf13/cobra"
+)
+
+var (
+	shareReadOnly bool
+	sharePrivate  bool
+	shareInclude  []string
+	shareExclude  []string
+	shareChunking string
+	shareChunkKiB int
+)
+
+var shareCmd = &cobra.Command{
+	Use:   "share",
+	Short: "Manage the directories shared by the running daemon.",
+}
+
+var shareAddCmd = &cobra.Command{
+	Use:   "add [name] [path]",
+	Short: "Start sharing a directory under a name.",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := filepath.Abs(args[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		sc := config.ShareConfig{
+			Name:         args[0],
+			Path:         path,
+			ReadOnly:     shareReadOnly,
+			Visibility:   config.VisibilityPublic,
+			Include:      shareInclude,
+			Exclude:      shareExclude,
+			Chunking:     shareChunking,
+			ChunkSizeKiB: shareChunkKiB,
+		}
+		if sharePrivate {
+			sc.Visibility = config.VisibilityPrivate
+		}
+		if err := sc.Validate(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+
+		payload, _ := json.Marshal(sc)
+		resp, err := http.Post(apiURL("/shares"), "application/json", bytes.NewBuffer(payload))
+		printDaemonResponse(resp, err)
+	},
+}
+
+var shareRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Stop sharing a directory. Files on disk are not touched.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		req, err := http.NewRequest(http.MethodDelete, apiURL("/shares/"+args[0]), nil)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		resp, err := http.DefaultClient.Do(req)
+		printDaemonResponse(resp, err)
+	},
+}
+
+var shareListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the shares of the running daemon.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		resp, err := http.Get(apiURL("/shares"))
+		if err != nil {
+			fmt.Println("Error: Could not connect to the go-peerfs daemon.")
+			fmt.Println("Please make sure the daemon is running with 'go-peerfs start'.")
+			return
+		}
+		defer resp.Body.Close()
+
+		var shares []config.ShareConfig
+		if err := json.NewDecoder(resp.Body).Decode(&shares); err != nil {
+			fmt.Printf("Error parsing share list: %v\n", err)
+			return
+		}
+
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 2, '\t', 0)
+		fmt.Fprintln(w, "NAME\tPATH\tVISIBILITY\tREAD-ONLY")
+		fmt.Fprintln(w, "----\t----\t----------\t---------")
+		for _, s := range shares {
+			visibility := config.VisibilityPublic
+			if !s.Public() {
+				visibility = config.VisibilityPrivate
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\n", s.Name, s.Path, visibility, s.ReadOnly)
+		}
+		w.Flush()
+	},
+}
+
+// printDaemonResponse prints the plain-text reply of a daemon API call.
+func printDaemonResponse(resp *http.Response, err error) {
+	if err != nil {
+		fmt.Println("Error: Could not connect to the go-peerfs daemon.")
+		fmt.Println("Please make sure the daemon is running with 'go-peerfs start'.")
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Error from daemon: %s - %s\n", resp.Status, string(body))
+	} else {
+		fmt.Println(string(body))
+	}
+}
+
+func init() {
+	shareAddCmd.Flags().BoolVar(&shareReadOnly, "read-only", false, "Never write into this share (it cannot be a download destination)")
+	shareAddCmd.Flags().BoolVar(&sharePrivate, "private", false, "Index for local use only; hide from other peers")
+	shareAddCmd.Flags().StringArrayVar(&shareInclude, "include", nil, "Only index files matching this glob (repeatable)")
+	shareAddCmd.Flags().StringArrayVar(&shareExclude, "exclude", nil, "Skip files and directories matching this gitignore-style pattern (repeatable)")
+	shareAddCmd.Flags().StringVar(&shareChunking, "chunking", file.ChunkingFixed, "How files are split into chunks: fixed or cdc (content-defined, better deduplication)")
+	shareAddCmd.Flags().IntVar(&shareChunkKiB, "chunk-size-kib", 0, "Chunk size in KiB, a power of two from 64 to 16384 (default: picked per file from its size)")
+	shareCmd.AddCommand(shareAddCmd, shareRemoveCmd, shareListCmd)
+	rootCmd.AddCommand(shareCmd)
+}
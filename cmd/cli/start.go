@@ -2,238 +2,95 @@ package cli
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
-	"path/filepath"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/Yashh56/go-peerfs/pkg/benchmark"
-	"github.com/Yashh56/go-peerfs/pkg/download"
-	"github.com/Yashh56/go-peerfs/pkg/file"
-	"github.com/Yashh56/go-peerfs/pkg/p2p"
-	"github.com/libp2p/go-libp2p/core/host"
-	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/Yashh56/go-peerfs/pkg/peerfs"
 	"github.com/spf13/cobra"
 )
 
-var apiPort int
+var (
+	apiPort     int
+	sharedDir   string
+	downloadDir string
+	rendezvous  string
+	listenAddrs []string
+	announce    []string
+	noAnnounce  []string
+	rebuild     bool
+)
 
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "Start the go-peerfs node and connect to the network.",
 	Run: func(cmd *cobra.Command, args []string) {
-		ctx := context.Background()
-		p2pHost, err := p2p.Host(ctx)
-		if err != nil {
-			log.Fatalf("Failed to create host: %v", err)
-		}
-		fmt.Println("Starting file indexing...")
-		startTime := time.Now()
-		sharedFiles, err := file.IndexDirectory("./shared")
+		applyStartFlags(cmd)
+
+		node, err := peerfs.New(cfg)
 		if err != nil {
-			log.Fatalf("Failed to index Directory: %v", err)
+			log.Fatal(err)
 		}
-		duration := time.Since(startTime) // Calculate duration
-		benchmark.LogResult("File Indexing", duration, fmt.Sprintf("%d files indexed", len(sharedFiles)))
-		fmt.Printf("File indexing completed in: %s\n", duration)
-
-		fmt.Printf("Sharing %d files.\n", len(sharedFiles))
-
-		p2p.SetStreamHandler(p2pHost, sharedFiles)
-		p2p.SetSearchHandler(p2pHost, sharedFiles)
-
-		go p2p.DiscoveryService(ctx, p2pHost)
-		fmt.Printf("NODE ID: %s\n", p2pHost.ID())
 
-		go startAPIServer(p2pHost, sharedFiles)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
 
-		fmt.Println("Node is Running. Press Ctrl+C to Exit.")
-		select {}
-	},
-}
-
-func startAPIServer(h host.Host, localFiles []file.FileMeta) {
-
-	handleSearch := func(w http.ResponseWriter, r *http.Request) {
-		queryValues := r.URL.Query()
-		query := queryValues.Get("q")
-		if query == "" {
-			http.Error(w, "Missing search query 'q'", http.StatusBadRequest)
-			return
+		if err := node.Start(ctx); err != nil {
+			log.Fatal(err)
 		}
-		fmt.Printf("API: Received search query '%s'\n", query)
 
-		type SearchResult struct {
-			Name     string `json:"name"`
-			Size     int64  `json:"size"`
-			FileHash string `json:"file_hash"`
-			PeerID   string `json:"peer_id"`
-		}
-		var allResults []SearchResult
+		fmt.Println("Node is Running. Press Ctrl+C to Exit.")
+		<-ctx.Done()
 
-		localResults := file.SearchLocal(localFiles, query)
-		for _, meta := range localResults {
-			allResults = append(allResults, SearchResult{
-				Name:     meta.Name,
-				Size:     meta.Size,
-				FileHash: meta.FileHash,
-				PeerID:   h.ID().String(), // Add our own ID
-			})
+		fmt.Println("Shutting down...")
+		if err := node.Close(); err != nil {
+			fmt.Printf("Error during shutdown: %v\n", err)
 		}
-		peers := h.Peerstore().Peers()
-		for _, p := range peers {
-			if p == h.ID() {
-				continue
-			}
-			results, err := p2p.RequestSearch(r.Context(), h, p, query)
+	},
+}
 
-			if err != nil {
-				fmt.Printf("Error Searching Peer %s: %v\n", p, err)
-				continue
-			}
-			for _, meta := range results {
-				allResults = append(allResults, SearchResult{
-					Name:     meta.Name,
-					Size:     meta.Size,
-					FileHash: meta.FileHash,
-					PeerID:   p.String(),
-				})
-			}
-		}
-		w.Header().Set("Content-type", "application/json")
-		json.NewEncoder(w).Encode(allResults)
+// applyStartFlags gives explicitly set flags precedence over the config
+// file and environment.
+func applyStartFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	if flags.Changed("port") {
+		cfg.API.Port = apiPort
 	}
-
-	handleFileMeta := func(w http.ResponseWriter, r *http.Request) {
-		hash := r.URL.Query().Get("hash")
-		if hash == "" {
-			http.Error(w, "Missing file hash", http.StatusBadRequest)
-			return
-		}
-
-		for _, meta := range localFiles {
-			if meta.FileHash == hash {
-				w.Header().Set("Content-type", "application/json")
-				json.NewEncoder(w).Encode(meta)
-				return
-			}
+	if flags.Changed("shared-dir") {
+		cfg.Shares = []config.ShareConfig{
+			{Name: "shared", Path: sharedDir, Visibility: config.VisibilityPublic},
 		}
-		http.Error(w, "File metadata not found", http.StatusNotFound)
 	}
-
-	handleDownload := func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		type DownloadRequest struct {
-			Meta      file.FileMeta `json:"meta"`
-			Providers []string      `json:"providers"`
-		}
-
-		var req DownloadRequest
-
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid Request body", http.StatusBadRequest)
-			return
-		}
-
-		var providerIDs []peer.ID
-		for _, pStr := range req.Providers {
-			id, err := peer.Decode(pStr)
-			if err != nil {
-				http.Error(w, "Invalid peer ID", http.StatusBadRequest)
-				return
-			}
-			providerIDs = append(providerIDs, id)
-		}
-
-		savePath := filepath.Join("./downloads", req.Meta.Name)
-		fmt.Printf("API: Received download request for '%s'\n", req.Meta.Name)
-
-		dlManager := download.NewDownloadManager(h, localFiles)
-		err := dlManager.DownloadFile(r.Context(), req.Meta, providerIDs, savePath)
-		if err != nil {
-			msg := fmt.Sprintf("Download failed: %v", err)
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
-		}
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Download successful! File saved to %s", savePath)
+	if flags.Changed("download-dir") {
+		cfg.DownloadDir = downloadDir
 	}
-
-	handleBenchmarkTransfer := func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		type DownloadRequest struct {
-			Meta      file.FileMeta `json:"meta"`
-			Providers []string      `json:"providers"`
-		}
-
-		var req DownloadRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		// --- FIX: DECLARE AND INITIALIZE THE MISSING VARIABLES ---
-		var providerIDs []peer.ID
-		for _, pStr := range req.Providers {
-			id, err := peer.Decode(pStr)
-			if err != nil {
-				http.Error(w, "Invalid peer ID", http.StatusBadRequest)
-				return
-			}
-			providerIDs = append(providerIDs, id)
-		}
-		// For a benchmark, we'll save to a temporary file.
-		savePath := filepath.Join("./downloads", "benchmark-"+req.Meta.Name)
-		// --- END OF FIX ---
-
-		// --- BENCHMARK LOGIC ---
-		startTime := time.Now()
-		dlManager := download.NewDownloadManager(h, localFiles)
-		err := dlManager.DownloadFile(r.Context(), req.Meta, providerIDs, savePath) // This line now works correctly
-		duration := time.Since(startTime)
-
-		if err != nil {
-			msg := fmt.Sprintf("Download failed: %v", err)
-			benchmark.LogResult("File Transfer", duration, "Result: FAILED - "+msg)
-			http.Error(w, msg, http.StatusInternalServerError)
-			return
-		}
-
-		// Calculate speed and log the successful result
-		fileSizeMB := float64(req.Meta.Size) / (1024 * 1024)
-		transferSpeed := fileSizeMB / duration.Seconds()
-		notes := fmt.Sprintf("File: %s, Size: %.2f MB, Speed: %.2f MB/s", req.Meta.Name, fileSizeMB, transferSpeed)
-		benchmark.LogResult("File Transfer", duration, "Result: SUCCESS - "+notes)
-
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "Benchmark complete. Results logged to benchmarks.txt.\n%s", notes)
+	if flags.Changed("rendezvous") {
+		cfg.Network.Rendezvous = rendezvous
 	}
-
-	http.HandleFunc("/search", handleSearch)
-	http.HandleFunc("/fileMeta", handleFileMeta)
-	http.HandleFunc("/download", handleDownload)
-	http.HandleFunc("/benchmark/transfer", handleBenchmarkTransfer) // Register the new handler
-
-	listenAddr := fmt.Sprintf(":%d", apiPort)
-	fmt.Printf("API Server listening on http://localhost%s\n", listenAddr)
-
-	if err := http.ListenAndServe(listenAddr, nil); err != nil {
-		log.Fatalf("Failed to start API server: %v", err)
+	if flags.Changed("listen") {
+		cfg.Network.Listen = listenAddrs
+	}
+	if flags.Changed("announce") {
+		cfg.Network.Announce = announce
+	}
+	if flags.Changed("no-announce") {
+		cfg.Network.NoAnnounce = noAnnounce
 	}
+	cfg.RebuildIndex = rebuild
 }
 
 func init() {
 	rootCmd.AddCommand(startCmd)
 	startCmd.Flags().IntVarP(&apiPort, "port", "p", 8000, "Port for the API server")
+	startCmd.Flags().StringVar(&sharedDir, "shared-dir", "./shared", "Share only this directory, replacing the shares from the config file")
+	startCmd.Flags().StringVar(&downloadDir, "download-dir", "./downloads", "Directory downloads are saved to")
+	startCmd.Flags().StringVar(&rendezvous, "rendezvous", "go-peerfs-rendezvous", "Discovery namespace; only nodes using the same one find each other")
+	startCmd.Flags().StringArrayVar(&listenAddrs, "listen", nil, "Multiaddr to listen on (repeatable), e.g. /ip4/0.0.0.0/udp/4001/quic-v1")
+	startCmd.Flags().StringArrayVar(&announce, "announce", nil, "Only advertise this multiaddr to peers (repeatable)")
+	startCmd.Flags().BoolVar(&rebuild, "rebuild-index", false, "Discard the stored index and re-hash every shared file")
+	startCmd.Flags().StringArrayVar(&noAnnounce, "no-announce", nil, "Never advertise this multiaddr or /ipcidr/ range (repeatable)")
 
 }
@@ -6,9 +6,7 @@ import (
 	"time"
 )
 
-const logFile = "benchmarks.txt"
-
-func LogResult(testName string, duration time.Duration, notes string) {
+func LogResult(logFile string, testName string, duration time.Duration, notes string) {
 	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		fmt.Printf("Error opening Benchmark log file: %v\n", err)
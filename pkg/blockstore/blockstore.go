@@ -0,0 +1,250 @@
+// Package blockstore keeps chunks on disk addressed by their hash. A chunk
+// that appears in several files, or is both shared and downloaded, is
+// stored once, and stays available when the file it came from is renamed
+// or deleted, until Collect removes it.
+package blockstore
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+// ErrFull is returned by Put when a block would take the store over
+// MaxSize.
+var ErrFull = errors.New("block store is full")
+
+// tempPrefix starts the names of blocks being written.
+const tempPrefix = ".put-"
+
+// Store is a directory of blocks, one file per chunk, named by the chunk's
+// hash and spread over subdirectories by its last two hex digits.
+type Store struct {
+	dir string
+	// MaxSize caps the bytes of blocks stored, 0 means no limit.
+	MaxSize int64
+
+	// mu serializes writes and deletes so size stays exact.
+	mu   sync.Mutex
+	size int64
+}
+
+// Open opens the block store in dir, creating it if needed. Blocks left
+// half-written by a crash are removed.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create block store: %w", err)
+	}
+	s := &Store{dir: dir}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), tempPrefix) {
+			return os.Remove(p)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		s.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open block store: %w", err)
+	}
+	return s, nil
+}
+
+// Size returns the bytes of blocks stored.
+func (s *Store) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// path returns where the block with the given hash is stored. Hashes come
+// from remote peers, so anything but a hash in canonical lowercase hex is
+// rejected before it gets near the file system.
+func (s *Store) path(hash string) (string, error) {
+	hash = file.NormalizeHash(hash)
+	if b, err := hex.DecodeString(hash); err != nil || hex.EncodeToString(b) != hash {
+		return "", fmt.Errorf("invalid block hash %q", hash)
+	}
+	if _, _, err := file.DecodeHash(hash); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, hash[len(hash)-2:], hash), nil
+}
+
+func (s *Store) Has(hash string) bool {
+	p, err := s.path(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(p)
+	return err == nil
+}
+
+// Get returns the block with the given hash.
+func (s *Store) Get(hash string) ([]byte, error) {
+	p, err := s.path(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("block %s not found", hash)
+	}
+	return data, err
+}
+
+// Put stores data under hash after checking that it matches. Storing a
+// block that is already present does nothing.
+func (s *Store) Put(hash string, data []byte) error {
+	p, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	if s.Has(hash) {
+		return nil
+	}
+	if err := file.VerifyHash(hash, data); err != nil {
+		return fmt.Errorf("block %s: %w", hash, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Has(hash) {
+		return nil
+	}
+	if s.MaxSize > 0 && s.size+int64(len(data)) > s.MaxSize {
+		return ErrFull
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	// Write to a temporary file first so a crash never leaves a partial
+	// block under its final name.
+	tmp, err := os.CreateTemp(filepath.Dir(p), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	s.size += int64(len(data))
+	return nil
+}
+
+func (s *Store) Delete(hash string) error {
+	p, err := s.path(hash)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeLocked(p)
+}
+
+func (s *Store) removeLocked(p string) error {
+	info, err := os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil {
+		return err
+	}
+	s.size -= info.Size()
+	return nil
+}
+
+// Collect deletes the blocks keep reports false for, unless they were
+// stored less than grace ago, and returns how many were deleted. The grace
+// period keeps freshly downloaded chunks around for reuse.
+func (s *Store) Collect(keep func(hash string) bool, grace time.Duration) (int, error) {
+	cutoff := time.Now().Add(-grace)
+	var stale []string
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return err
+		}
+		if keep(d.Name()) {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().Before(cutoff) {
+			stale = append(stale, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for _, p := range stale {
+		// The block may have been referenced again since the walk.
+		if keep(filepath.Base(p)) {
+			continue
+		}
+		if err := s.removeLocked(p); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// ImportFile copies the chunks of an indexed file that are not stored yet
+// and returns how many were added.
+func (s *Store) ImportFile(meta file.FileMeta) (int, error) {
+	var f *os.File
+	added := 0
+	for _, chunk := range meta.Chunks {
+		if s.Has(chunk.Hash) {
+			continue
+		}
+		if f == nil {
+			var err error
+			if f, err = os.Open(meta.Path); err != nil {
+				return added, err
+			}
+			defer f.Close()
+		}
+		data := make([]byte, chunk.Length)
+		if _, err := f.ReadAt(data, chunk.Offset); err != nil && !errors.Is(err, io.EOF) {
+			return added, err
+		}
+		// Put rejects the chunk if the file changed since it was indexed;
+		// the watcher will index it again.
+		if err := s.Put(chunk.Hash, data); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, nil
+}
@@ -0,0 +1,158 @@
+package blockstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+// hashOf returns the SHA-256 hash of data as the indexer writes it.
+func hashOf(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestImportDedupsAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(filepath.Join(dir, "blocks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("the same contents in two files")
+	var metas []file.FileMeta
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		meta, err := file.NewHasher(1, 0).HashFile(path, info, file.ChunkingFixed, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		metas = append(metas, meta)
+	}
+
+	if added, err := store.ImportFile(metas[0]); err != nil || added != 1 {
+		t.Fatalf("Expected 1 block added, got %d (%v)", added, err)
+	}
+	if added, err := store.ImportFile(metas[1]); err != nil || added != 0 {
+		t.Fatalf("Expected the identical chunk to be stored once, got %d added (%v)", added, err)
+	}
+
+	// The block outlives the files it came from.
+	os.Remove(metas[0].Path)
+	os.Remove(metas[1].Path)
+	got, err := store.Get(metas[1].Chunks[0].Hash)
+	if err != nil || string(got) != string(data) {
+		t.Fatalf("Expected the stored block, got %q (%v)", got, err)
+	}
+}
+
+func TestPutRejectsMismatchedData(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := file.NormalizeHash("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824") // sha256("hello")
+	if err := store.Put(hash, []byte("goodbye")); err == nil {
+		t.Error("Expected data not matching its hash to be rejected")
+	}
+	if store.Has(hash) {
+		t.Error("Rejected block was stored")
+	}
+	if err := store.Put(hash, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if !store.Has(hash) {
+		t.Error("Expected the block to be stored")
+	}
+}
+
+func TestRejectsNonCanonicalHashes(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(filepath.Join(dir, "blocks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{
+		"../../secret",
+		"../secret",
+		"",
+		"2CF24DBA5FB0A30E26E83B2AC5B9E29E1B161E5C1FA7425E73043362938B9824",
+		"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b98/4",
+	} {
+		if _, err := store.Get(hash); err == nil {
+			t.Errorf("Expected Get(%q) to fail", hash)
+		}
+		if store.Has(hash) {
+			t.Errorf("Expected Has(%q) to be false", hash)
+		}
+		if err := store.Put(hash, []byte("secret")); err == nil {
+			t.Errorf("Expected Put(%q) to fail", hash)
+		}
+	}
+}
+
+func TestCollect(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []string
+	for _, data := range []string{"kept", "unused"} {
+		hash := hashOf(data)
+		if err := store.Put(hash, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	keep := func(hash string) bool { return hash == hashes[0] }
+
+	if deleted, err := store.Collect(keep, time.Hour); err != nil || deleted != 0 {
+		t.Fatalf("Expected blocks within the grace period to be kept, got %d deleted (%v)", deleted, err)
+	}
+	if deleted, err := store.Collect(keep, 0); err != nil || deleted != 1 {
+		t.Fatalf("Expected 1 block deleted, got %d (%v)", deleted, err)
+	}
+	if !store.Has(hashes[0]) || store.Has(hashes[1]) {
+		t.Error("Expected only the referenced block to remain")
+	}
+	if got := store.Size(); got != int64(len("kept")) {
+		t.Errorf("Expected size %d, got %d", len("kept"), got)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.MaxSize = 10
+	first, second := hashOf("123456"), hashOf("abcdef")
+	if err := store.Put(first, []byte("123456")); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(second, []byte("abcdef")); !errors.Is(err, ErrFull) {
+		t.Fatalf("Expected ErrFull, got %v", err)
+	}
+
+	reopened, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reopened.Size(); got != 6 {
+		t.Errorf("Expected a reopened store to count 6 bytes, got %d", got)
+	}
+}
@@ -0,0 +1,436 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	ma "github.com/multiformats/go-multiaddr"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FileName  = "config.yaml"
+	EnvPrefix = "PEERFS_"
+)
+
+// Default download limits, also used by download managers created without
+// a config.
+const (
+	DefaultDownloadConcurrency = 16
+	DefaultDownloadPerPeer     = 4
+)
+
+type Config struct {
+	// DataDir is where the config file, identity and other node state live.
+	// It is chosen before the config file is read, so it is never stored in it.
+	DataDir string `yaml:"-"`
+	// RebuildIndex discards the stored index on start. It is a one-off
+	// request from the command line, never read from the config file.
+	RebuildIndex bool `yaml:"-"`
+
+	Shares      []ShareConfig    `yaml:"shares"`
+	DownloadDir string           `yaml:"download_dir"`
+	Download    DownloadConfig   `yaml:"download"`
+	API         APIConfig        `yaml:"api"`
+	Network     NetworkConfig    `yaml:"network"`
+	Index       IndexConfig      `yaml:"index"`
+	BlockStore  BlockStoreConfig `yaml:"blockstore"`
+	Watch       WatchConfig      `yaml:"watch"`
+	Benchmark   BenchmarkConfig  `yaml:"benchmark"`
+}
+
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+type ShareConfig struct {
+	Name string `yaml:"name" json:"name"`
+	Path string `yaml:"path" json:"path"`
+	// ReadOnly shares are never written to; only writable shares can be
+	// chosen as a download destination.
+	ReadOnly bool `yaml:"read_only" json:"read_only"`
+	// Visibility is public (searchable and downloadable by peers) or
+	// private (indexed for local use only).
+	Visibility string   `yaml:"visibility" json:"visibility"`
+	Include    []string `yaml:"include,omitempty" json:"include,omitempty"`
+	Exclude    []string `yaml:"exclude,omitempty" json:"exclude,omitempty"`
+	// Chunking is fixed (the default, chunks of one size) or cdc
+	// (content-defined chunks, so edited versions of a file share most
+	// chunks).
+	Chunking string `yaml:"chunking,omitempty" json:"chunking,omitempty"`
+	// ChunkSizeKiB fixes the chunk size (the average size for cdc) of every
+	// file in the share. When 0 it is picked per file from the file size.
+	ChunkSizeKiB int `yaml:"chunk_size_kib,omitempty" json:"chunk_size_kib,omitempty"`
+}
+
+func (s ShareConfig) Public() bool {
+	return s.Visibility != VisibilityPrivate
+}
+
+func (c *Config) Share(name string) (ShareConfig, bool) {
+	for _, s := range c.Shares {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return ShareConfig{}, false
+}
+
+type DownloadConfig struct {
+	// Concurrency caps the chunk requests in flight across all downloads,
+	// and PerPeer those one download sends to any one provider.
+	Concurrency int `yaml:"concurrency"`
+	PerPeer     int `yaml:"per_peer"`
+	// Jobs is how many queued downloads run at once.
+	Jobs int `yaml:"jobs"`
+}
+
+type APIConfig struct {
+	// Port is the local API port; 0 picks a free one.
+	Port int `yaml:"port"`
+}
+
+type NetworkConfig struct {
+	Listen     []string `yaml:"listen"`
+	Announce   []string `yaml:"announce"`
+	NoAnnounce []string `yaml:"no_announce"`
+	Rendezvous string   `yaml:"rendezvous"`
+	// Provide controls which hashes are announced as DHT provider records.
+	Provide ProvideConfig `yaml:"provide"`
+}
+
+const (
+	// ProvideAll announces every file, directory and chunk hash.
+	ProvideAll = "all"
+	// ProvideRoots announces file and directory hashes only.
+	ProvideRoots = "roots"
+	ProvideNone  = "none"
+)
+
+type ProvideConfig struct {
+	Strategy string `yaml:"strategy"`
+	// Interval is how often every record is announced again; DHT records
+	// expire after a day.
+	Interval time.Duration `yaml:"interval"`
+}
+
+type IndexConfig struct {
+	// Exclude holds gitignore-style patterns applied to every share, before
+	// the share's own exclude list and its .peerfsignore files.
+	Exclude []string `yaml:"exclude"`
+	// Workers is how many chunks are hashed at once; 0 uses one per CPU.
+	Workers int `yaml:"workers"`
+	// ReadLimitMiB caps indexing reads in MiB per second so hashing does
+	// not starve transfers; 0 means unlimited.
+	ReadLimitMiB int `yaml:"read_limit_mib"`
+	// Hash is the algorithm newly indexed files are hashed with. Peers
+	// verify with whatever algorithm a hash names, so it can be changed
+	// without breaking downloads from nodes using the other one.
+	Hash string `yaml:"hash"`
+}
+
+// BlockStoreConfig controls the block store in <data-dir>/blocks, which
+// keeps a copy of every chunk of the public shares and every downloaded
+// chunk, each stored once however many files contain it.
+type BlockStoreConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxSizeMiB caps the disk space the block store uses; chunks that do
+	// not fit are not copied in. 0 means no limit.
+	MaxSizeMiB int `yaml:"max_size_mib"`
+}
+
+type WatchConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Debounce is how long a path must be quiet before it is re-indexed, so
+	// a file being copied in is hashed once, after the copy finishes.
+	Debounce time.Duration `yaml:"debounce"`
+}
+
+type BenchmarkConfig struct {
+	LogFile string `yaml:"log_file"`
+}
+
+func Default(dataDir string) *Config {
+	return &Config{
+		DataDir: dataDir,
+		Shares: []ShareConfig{
+			{Name: "shared", Path: "./shared", Visibility: VisibilityPublic},
+		},
+		DownloadDir: "./downloads",
+		Download: DownloadConfig{
+			Concurrency: DefaultDownloadConcurrency,
+			PerPeer:     DefaultDownloadPerPeer,
+			Jobs:        2,
+		},
+		API: APIConfig{
+			Port: 8000,
+		},
+		Network: NetworkConfig{
+			Rendezvous: "go-peerfs-rendezvous",
+			Provide: ProvideConfig{
+				Strategy: ProvideRoots,
+				Interval: 12 * time.Hour,
+			},
+		},
+		Index: IndexConfig{
+			Exclude: []string{".git/", ".hg/", ".svn/", ".DS_Store", "*.swp", "*.swo", "*~", "*.tmp", "*.part"},
+			Hash:    file.DefaultHash,
+		},
+		Watch: WatchConfig{
+			Enabled:  true,
+			Debounce: 500 * time.Millisecond,
+		},
+		Benchmark: BenchmarkConfig{
+			LogFile: "benchmarks.txt",
+		},
+	}
+}
+
+func Path(dataDir string) string {
+	return filepath.Join(dataDir, FileName)
+}
+
+// Load builds the effective configuration for dataDir: defaults, overlaid by
+// the config file if one exists, overlaid by PEERFS_* environment variables.
+// Command line flags are applied on top by the caller.
+func Load(dataDir string) (*Config, error) {
+	cfg, err := loadFile(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyEnv(cfg, os.LookupEnv); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(dataDir string) (*Config, error) {
+	cfg := Default(dataDir)
+
+	data, err := os.ReadFile(Path(dataDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", Path(dataDir), err)
+		}
+	}
+	return cfg, nil
+}
+
+// UpdateFile applies change to the config file of dataDir and saves it.
+// Only the file is rewritten; environment and flag overrides of the
+// running process are not persisted.
+func UpdateFile(dataDir string, change func(*Config)) error {
+	cfg, err := loadFile(dataDir)
+	if err != nil {
+		return err
+	}
+	change(cfg)
+	return cfg.Save()
+}
+
+func (c *Config) Save() error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.DataDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(Path(c.DataDir), data, 0600)
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+	names := make(map[string]bool)
+	for _, share := range c.Shares {
+		if err := share.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+		if names[share.Name] {
+			errs = append(errs, fmt.Errorf("share %q is declared more than once", share.Name))
+		}
+		names[share.Name] = true
+	}
+	if c.DownloadDir == "" {
+		errs = append(errs, errors.New("download_dir must not be empty"))
+	}
+	if c.Download.Concurrency < 1 {
+		errs = append(errs, errors.New("download.concurrency must be at least 1"))
+	}
+	if c.Download.PerPeer < 1 {
+		errs = append(errs, errors.New("download.per_peer must be at least 1"))
+	}
+	if c.Download.Jobs < 1 {
+		errs = append(errs, errors.New("download.jobs must be at least 1"))
+	}
+	if c.API.Port < 0 || c.API.Port > 65535 {
+		errs = append(errs, fmt.Errorf("api.port %d is out of range", c.API.Port))
+	}
+	for _, p := range c.Index.Exclude {
+		if _, err := path.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("index.exclude: invalid pattern %q", p))
+		}
+	}
+	if c.Index.Workers < 0 {
+		errs = append(errs, errors.New("index.workers must not be negative"))
+	}
+	if c.Index.ReadLimitMiB < 0 {
+		errs = append(errs, errors.New("index.read_limit_mib must not be negative"))
+	}
+	if !file.ValidHash(c.Index.Hash) {
+		errs = append(errs, fmt.Errorf("index.hash must be %s or %s", file.HashSHA256, file.HashBLAKE3))
+	}
+	if c.BlockStore.MaxSizeMiB < 0 {
+		errs = append(errs, errors.New("blockstore.max_size_mib must not be negative"))
+	}
+	if c.Watch.Debounce < 0 {
+		errs = append(errs, errors.New("watch.debounce must not be negative"))
+	}
+	if c.Network.Rendezvous == "" {
+		errs = append(errs, errors.New("network.rendezvous must not be empty"))
+	}
+	switch c.Network.Provide.Strategy {
+	case ProvideAll, ProvideRoots, ProvideNone:
+	default:
+		errs = append(errs, fmt.Errorf("network.provide.strategy must be %s, %s or %s", ProvideAll, ProvideRoots, ProvideNone))
+	}
+	if c.Network.Provide.Interval <= 0 {
+		errs = append(errs, errors.New("network.provide.interval must be positive"))
+	}
+	for _, list := range []struct {
+		name  string
+		addrs []string
+	}{
+		{"network.listen", c.Network.Listen},
+		{"network.announce", c.Network.Announce},
+		{"network.no_announce", c.Network.NoAnnounce},
+	} {
+		for _, s := range list.addrs {
+			if _, err := ma.NewMultiaddr(s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid multiaddr %q: %w", list.name, s, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s ShareConfig) Validate() error {
+	var errs []error
+	if !validShareName.MatchString(s.Name) {
+		errs = append(errs, fmt.Errorf("share name %q must be letters, digits, '-' or '_'", s.Name))
+	}
+	if s.Path == "" {
+		errs = append(errs, fmt.Errorf("share %q: path must not be empty", s.Name))
+	}
+	if s.Visibility != "" && s.Visibility != VisibilityPublic && s.Visibility != VisibilityPrivate {
+		errs = append(errs, fmt.Errorf("share %q: visibility must be %s or %s", s.Name, VisibilityPublic, VisibilityPrivate))
+	}
+	if s.Chunking != "" && s.Chunking != file.ChunkingFixed && s.Chunking != file.ChunkingCDC {
+		errs = append(errs, fmt.Errorf("share %q: chunking must be %s or %s", s.Name, file.ChunkingFixed, file.ChunkingCDC))
+	}
+	if kib := s.ChunkSizeKiB; kib != 0 && (kib < file.MinChunkSize>>10 || kib > file.MaxChunkSize>>10 || kib&(kib-1) != 0) {
+		errs = append(errs, fmt.Errorf("share %q: chunk_size_kib must be a power of two from %d to %d", s.Name, file.MinChunkSize>>10, file.MaxChunkSize>>10))
+	}
+	for _, p := range append(append([]string{}, s.Include...), s.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("share %q: invalid pattern %q", s.Name, p))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var validShareName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ApplyEnv overrides fields from environment variables named after their
+// YAML path, e.g. api.port is PEERFS_API_PORT. List values are comma
+// separated.
+func ApplyEnv(c *Config, lookup func(string) (string, bool)) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), EnvPrefix, lookup)
+}
+
+func applyEnv(v reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + strings.ToUpper(name)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct {
+			continue
+		}
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnv(fv, key+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		raw, ok := lookup(key)
+		if !ok {
+			continue
+		}
+		if err := setValue(fv, raw); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLayersFileAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("shares:\n  - name: datasets\n    path: /srv/share\napi:\n  port: 9000\nnetwork:\n  rendezvous: team-a\n")
+	if err := os.WriteFile(filepath.Join(dir, FileName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("PEERFS_API_PORT", "9100")
+	t.Setenv("PEERFS_NETWORK_LISTEN", "/ip4/0.0.0.0/tcp/4001, /ip4/0.0.0.0/udp/4001/quic-v1")
+
+	cfg, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Shares) != 1 || cfg.Shares[0].Path != "/srv/share" {
+		t.Errorf("Expected shares from file, got %+v", cfg.Shares)
+	}
+	if cfg.DownloadDir != "./downloads" {
+		t.Errorf("Expected default download_dir, got %s", cfg.DownloadDir)
+	}
+	if cfg.API.Port != 9100 {
+		t.Errorf("Expected env to override port, got %d", cfg.API.Port)
+	}
+	if cfg.Network.Rendezvous != "team-a" {
+		t.Errorf("Expected rendezvous from file, got %s", cfg.Network.Rendezvous)
+	}
+	if len(cfg.Network.Listen) != 2 {
+		t.Errorf("Expected 2 listen addresses from env, got %v", cfg.Network.Listen)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default(t.TempDir())
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected default config to be valid, got %v", err)
+	}
+
+	cfg.API.Port = -1
+	cfg.Network.Listen = []string{"tcp://0.0.0.0:4001"}
+	cfg.Shares = append(cfg.Shares, cfg.Shares[0])
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation errors, got none")
+	}
+}
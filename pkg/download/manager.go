@@ -2,109 +2,658 @@ package download
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"math/bits"
+	"net"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/Yashh56/go-peerfs/pkg/blockstore"
+	"github.com/Yashh56/go-peerfs/pkg/config"
 	"github.com/Yashh56/go-peerfs/pkg/file"
 	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 type DownloadManager struct {
-	Host       host.Host
-	LocalFiles []file.FileMeta
+	Host  host.Host
+	Index *file.Index
+	// Blocks, if not nil, is checked for chunks before the network and
+	// keeps a copy of every chunk downloaded.
+	Blocks *blockstore.Store
+	// DHT, if not nil, is searched for provider records of the files
+	// being downloaded.
+	DHT *dht.IpfsDHT
+	// Concurrency caps the chunk requests in flight across all downloads,
+	// shared out by job priority, and PerPeer those one download sends to
+	// any one provider.
+	Concurrency int
+	PerPeer     int
+	// StateDir keeps the progress of unfinished downloads so they resume,
+	// even after a restart; if empty every download starts over.
+	StateDir string
+	// OnProgress, if set, receives a Progress report of every file download
+	// about twice a second, and once more when it ends.
+	OnProgress func(Progress)
+
+	mu sync.Mutex
+	// active holds the hashes being downloaded, as a hash has a single
+	// state file and .part file.
+	active map[string]bool
+	sched  *scheduler
 }
 
-func NewDownloadManager(h host.Host, localFiles []file.FileMeta) *DownloadManager {
+func NewDownloadManager(h host.Host, index *file.Index, blocks *blockstore.Store, kadDHT *dht.IpfsDHT) *DownloadManager {
 	return &DownloadManager{
-		Host:       h,
-		LocalFiles: localFiles,
+		Host:   h,
+		Index:  index,
+		Blocks: blocks,
+		DHT:    kadDHT,
+
+		Concurrency: config.DefaultDownloadConcurrency,
+		PerPeer:     config.DefaultDownloadPerPeer,
 	}
 }
 
+// proofLevel is the Merkle tree level at which chunk records are fetched:
+// one proof request covers 2^proofLevel chunks.
+const proofLevel = 8
+
+// DownloadFile downloads a file to savePath. providers seed the set of
+// peers to fetch from; more are looked up if it is empty, and peers found
+// to have the file while the download runs are used for the remaining
+// chunks. Chunks are fetched concurrently, within the Concurrency shared
+// by all downloads and at most PerPeer at once from any one provider, and
+// each is written at its offset as soon as it is verified.
+//
+// The file is written to savePath plus PartSuffix and only renamed to
+// savePath once its hash verifies. If the download fails, the chunks
+// written so far are kept and a later download of the same hash resumes
+// from them.
 func (dm *DownloadManager) DownloadFile(ctx context.Context, meta file.FileMeta, providers []peer.ID, savePath string) error {
-	numChunks := len(meta.ChunkHash)
+	return dm.downloadFile(ctx, "", meta, providers, savePath)
+}
+
+// downloadFile is DownloadFile for the queued job with the given ID, or
+// for no job if it is empty.
+func (dm *DownloadManager) downloadFile(ctx context.Context, job string, meta file.FileMeta, providers []peer.ID, savePath string) error {
+	numChunks := meta.NumChunks
+	root := meta.MerkleRoot
+	if _, _, err := file.DecodeHash(root); err != nil || root == "" {
+		return fmt.Errorf("metadata contains no valid merkle root, cannot download")
+	}
 	if numChunks == 0 {
-		return fmt.Errorf("metadata contains no chunk hashes, cannot download")
+		return fmt.Errorf("metadata contains no chunks, cannot download")
+	}
+	if _, _, err := file.DecodeHash(meta.FileHash); err != nil {
+		return fmt.Errorf("metadata contains no valid file hash: %w", err)
+	}
+	if !dm.begin(meta.FileHash) {
+		return fmt.Errorf("%s is already being downloaded", meta.FileHash)
+	}
+	defer dm.end(meta.FileHash)
+
+	set := &providerSet{}
+	set.add(providers...)
+	if len(providers) == 0 {
+		set.add(dm.FindProviders(ctx, meta.FileHash)...)
 	}
+	trackCtx, stopTracking := context.WithCancel(ctx)
+	tracking := make(chan struct{})
+	go func() {
+		defer close(tracking)
+		dm.track(trackCtx, meta.FileHash, set)
+	}()
+	defer func() {
+		stopTracking()
+		<-tracking
+	}()
 
-	f, err := os.Create(savePath)
+	state := dm.loadState(meta)
+	state.Job = job
+	part := savePath + PartSuffix
+	f, err := openPart(state, part)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	fmt.Printf("Starting sequential download of %d chunks...\n", numChunks)
+	workers := min(dm.Concurrency, numChunks)
+	fmt.Printf("Starting download of %d chunks from %d providers, %d at a time...\n", numChunks, len(set.list()), workers)
 
-	for i := 0; i < numChunks; i++ {
-		provider := providers[i%len(providers)]
-		chunkIndex := i
-		var chunkData []byte
-		var err error
+	d := &fileDownload{
+		job:   job,
+		f:     f,
+		state: state,
+		set:   set,
+		slots: newPeerSlots(dm.PerPeer),
+		bad:   &strikes{},
+		prog:  newProgress(job, meta.Name, meta.FileHash, meta.Size, numChunks),
+	}
+	if dm.OnProgress != nil {
+		reportCtx, stopReporting := context.WithCancel(ctx)
+		reporting := make(chan struct{})
+		go func() {
+			defer close(reporting)
+			dm.reportProgress(reportCtx, d.prog)
+		}()
+		defer func() {
+			stopReporting()
+			<-reporting
+			last := d.prog.snapshot()
+			last.Finished = true
+			dm.OnProgress(last)
+		}()
+	}
 
-		if provider == dm.Host.ID() {
-			fmt.Printf("Reading chunk %d from local disk...\n", chunkIndex)
-			chunkData, err = dm.readLocalChunk(meta.FileHash, chunkIndex)
-		} else {
-			fmt.Printf("Requesting chunk %d from remote peer %s...\n", chunkIndex, provider)
-			chunkData, err = p2p.RequestChunk(ctx, dm.Host, provider, meta.FileHash, chunkIndex)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	records := make([]file.ChunkRecord, numChunks)
+	queue := make(chan int)
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				if err := dm.downloadChunk(ctx, d, i, records[i]); err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	err = dm.dispatch(ctx, meta, d.set, records, queue)
+	close(queue)
+	wg.Wait()
+	close(errs)
+	if chunkErr := <-errs; chunkErr != nil {
+		err = chunkErr
+	}
+	if err != nil {
+		if saveErr := state.save(); saveErr != nil {
+			fmt.Printf("Failed to save download state: %v\n", saveErr)
 		}
+		fmt.Printf("Download stopped with %d of %d chunks done; it resumes when requested again.\n", state.count(), numChunks)
+		return err
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to get chunk %d: %w", chunkIndex, err)
+	// The Merkle root proves each chunk, but only the whole file proves
+	// that the root belongs to the requested file hash. Resuming cannot
+	// fix a mismatch, so the partial download is dropped.
+	verifyErr := verifyFile(f, meta.FileHash)
+	f.Close()
+	if verifyErr != nil {
+		os.Remove(part)
+		state.remove()
+		return fmt.Errorf("downloaded file does not match hash %s", meta.FileHash)
+	}
+	if err := os.Rename(part, savePath); err != nil {
+		return err
+	}
+	state.remove()
+
+	fmt.Println("File download complete!")
+	return nil
+}
+
+func (dm *DownloadManager) begin(hash string) bool {
+	hash = file.NormalizeHash(hash)
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if dm.active[hash] {
+		return false
+	}
+	if dm.active == nil {
+		dm.active = make(map[string]bool)
+	}
+	dm.active[hash] = true
+	return true
+}
+
+func (dm *DownloadManager) end(hash string) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	delete(dm.active, file.NormalizeHash(hash))
+}
+
+// scheduler returns the scheduler of chunk requests, created with the
+// Concurrency set when it is first needed.
+func (dm *DownloadManager) scheduler() *scheduler {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if dm.sched == nil {
+		dm.sched = newScheduler(dm.Concurrency)
+	}
+	return dm.sched
+}
+
+// openPart opens the .part file of a download. The .part file of an
+// earlier attempt is moved to part if it was saved elsewhere; if it cannot
+// be, the download starts over.
+func openPart(state *downloadState, part string) (*os.File, error) {
+	if done := state.count(); done > 0 {
+		if state.Part != part {
+			if err := os.Rename(state.Part, part); err != nil {
+				state.reset()
+			}
+		}
+		if done = state.count(); done > 0 {
+			fmt.Printf("Resuming download: %d of %d chunks already done\n", done, state.NumChunks)
 		}
+	}
+	state.Part = part
 
-		expectedHash := meta.ChunkHash[chunkIndex]
-		hasher := sha256.New()
-		hasher.Write(chunkData)
-		receivedHash := hex.EncodeToString(hasher.Sum(nil))
+	flags := os.O_RDWR | os.O_CREATE
+	if state.count() == 0 {
+		flags |= os.O_TRUNC
+	}
+	return os.OpenFile(part, flags, 0644)
+}
 
-		if receivedHash != expectedHash {
-			return fmt.Errorf("chunk %d verification failed! Corrupted data", chunkIndex)
+// DownloadCollection downloads every file of a collection, recreating its
+// tree in a directory named after it under saveDir, and returns that
+// directory. Files already saved there are kept, so downloading the
+// collection again resumes it. Providers are looked up as for
+// DownloadFile, and those of the collection seed the download of each
+// file.
+func (dm *DownloadManager) DownloadCollection(ctx context.Context, hash string, providers []peer.ID, saveDir string) (string, error) {
+	return dm.downloadCollection(ctx, "", hash, providers, saveDir)
+}
+
+// downloadCollection is DownloadCollection for the queued job with the
+// given ID, or for no job if it is empty.
+func (dm *DownloadManager) downloadCollection(ctx context.Context, job, hash string, providers []peer.ID, saveDir string) (string, error) {
+	if _, _, ok := dm.Index.LookupCollection(hash); !ok && len(providers) == 0 {
+		providers = dm.FindProviders(ctx, hash)
+	}
+	coll, err := dm.collection(ctx, hash, providers)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(saveDir, coll.Name)
+	fmt.Printf("Downloading collection %s: %d files...\n", coll.Name, len(coll.Entries))
+	for i, entry := range coll.Entries {
+		savePath := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+			return dir, err
+		}
+		fmt.Printf("[%d/%d] %s\n", i+1, len(coll.Entries), entry.Path)
+		if entry.Size == 0 {
+			// Empty files have no chunks to fetch.
+			f, err := os.Create(savePath)
+			if err != nil {
+				return dir, err
+			}
+			f.Close()
+			continue
+		}
+		if complete(savePath, entry.Meta()) {
+			fmt.Println("Already downloaded.")
+			continue
 		}
+		if err := dm.downloadFile(ctx, job, entry.Meta(), providers, savePath); err != nil {
+			return dir, fmt.Errorf("%s: %w", entry.Path, err)
+		}
+	}
+	fmt.Println("Collection download complete!")
+	return dir, nil
+}
 
-		if _, err := f.Write(chunkData); err != nil {
-			return fmt.Errorf("failed to write chunk %d to file: %w", chunkIndex, err)
+// dispatch fetches the chunk records one proof at a time and queues each
+// chunk once its record is verified, so the records of the next chunks are
+// fetched while earlier ones download.
+func (dm *DownloadManager) dispatch(ctx context.Context, meta file.FileMeta, set *providerSet, records []file.ChunkRecord, queue chan<- int) error {
+	level := min(proofLevel, bits.Len(uint(meta.NumChunks-1)))
+	var offset int64
+	for start := 0; start < meta.NumChunks; start += 1 << level {
+		chunks, err := dm.chunkRecords(ctx, meta, meta.MerkleRoot, set.list(), level, start>>level)
+		if err != nil {
+			return err
 		}
-		fmt.Printf("Successfully downloaded and wrote chunk %d\n", chunkIndex)
+		for k, chunk := range chunks {
+			i := start + k
+			if err := checkChunk(meta, i, chunk, offset); err != nil {
+				return err
+			}
+			offset += chunk.Length
+			records[i] = chunk
+			select {
+			case queue <- i:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+	if offset != meta.Size {
+		return fmt.Errorf("chunks cover %d bytes, expected %d", offset, meta.Size)
 	}
+	return nil
+}
 
-	fmt.Println("File download complete!")
+// checkChunk checks that chunk i of meta starts at offset, where the one
+// before it ended, and lies within the file. The Merkle root only covers
+// chunk hashes, so a provider could otherwise shift chunks around or make
+// the download allocate a chunk larger than the file.
+func checkChunk(meta file.FileMeta, i int, chunk file.ChunkRecord, offset int64) error {
+	if chunk.Offset != offset {
+		return fmt.Errorf("chunk %d starts at %d, expected %d", i, chunk.Offset, offset)
+	}
+	if chunk.Length <= 0 || chunk.Length > meta.Size-offset {
+		return fmt.Errorf("chunk %d is %d bytes long, which does not fit in the file", i, chunk.Length)
+	}
+	if chunk.Length > file.MaxChunkSize {
+		return fmt.Errorf("chunk %d is %d bytes long, more than the %d allowed", i, chunk.Length, file.MaxChunkSize)
+	}
 	return nil
 }
 
-func (dm *DownloadManager) readLocalChunk(fileHash string, chunkIndex int) ([]byte, error) {
-	var localMeta *file.FileMeta
-	for _, f := range dm.LocalFiles {
-		if f.FileHash == fileHash {
-			localMeta = &f
-			break
+// fileDownload is what the workers of one DownloadFile call share.
+type fileDownload struct {
+	// job is the ID of the queued job the download runs for, if any.
+	job   string
+	f     *os.File
+	state *downloadState
+	set   *providerSet
+	slots *peerSlots
+	bad   *strikes
+	prog  *progress
+}
+
+// downloadChunk gets chunk index from a local copy or a provider and
+// writes it to the .part file at its offset. A chunk the state records as
+// done is only checked.
+func (dm *DownloadManager) downloadChunk(ctx context.Context, d *fileDownload, index int, chunk file.ChunkRecord) error {
+	if d.state.done(index) {
+		data := make([]byte, chunk.Length)
+		if _, err := d.f.ReadAt(data, chunk.Offset); err == nil && verifyChunk(chunk, data) == nil {
+			d.prog.add("", chunk.Length)
+			return nil
 		}
+		fmt.Printf("Chunk %d of the partial download is damaged, fetching it again\n", index)
+	}
+
+	data, err := dm.localChunk(index, chunk)
+	if err != nil {
+		fmt.Printf("Local copy of chunk %d is unusable: %v\n", index, err)
+	}
+	var provider peer.ID
+	if data == nil {
+		data, provider, err = dm.fetchChunk(ctx, d, index, chunk)
+		if err != nil {
+			return fmt.Errorf("failed to get chunk %d: %w", index, err)
+		}
+	}
+	if dm.Blocks != nil {
+		// A full block store only means the chunk is not cached.
+		if err := dm.Blocks.Put(chunk.Hash, data); err != nil && !errors.Is(err, blockstore.ErrFull) {
+			fmt.Printf("Failed to cache chunk %d: %v\n", index, err)
+		}
+	}
+	if _, err := d.f.WriteAt(data, chunk.Offset); err != nil {
+		return fmt.Errorf("failed to write chunk %d to file: %w", index, err)
 	}
-	if localMeta == nil {
-		return nil, fmt.Errorf("could not find local file metadata for hash %s", fileHash)
+	d.state.mark(index)
+	d.prog.add(provider, chunk.Length)
+	fmt.Printf("Successfully downloaded and wrote chunk %d\n", index)
+	return nil
+}
+
+// localChunk returns a verified chunk from the block store or a local file
+// containing it, or nil if there is none. Local copies are checked too, as
+// files may have changed since they were hashed.
+func (dm *DownloadManager) localChunk(index int, chunk file.ChunkRecord) ([]byte, error) {
+	var data []byte
+	var err error
+	if dm.Blocks != nil && dm.Blocks.Has(chunk.Hash) {
+		fmt.Printf("Reading chunk %d from the block store...\n", index)
+		data, err = dm.Blocks.Get(chunk.Hash)
+	} else if _, _, ok := dm.Index.LookupChunk(chunk.Hash); ok {
+		fmt.Printf("Reading chunk %d from local disk...\n", index)
+		data, err = dm.readLocalChunk(chunk.Hash)
+	} else {
+		return nil, nil
 	}
+	if err == nil {
+		err = verifyChunk(chunk, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
 
-	f, err := os.Open(localMeta.Path)
+// fetchChunk gets a chunk, and the provider that sent it. Each attempt
+// goes to the least busy provider not tried yet, waiting for a free slot
+// if all of them are at their limit; ties go to the provider at the
+// chunk's index, so consecutive chunks are spread over them. Once every
+// provider has failed, the round is repeated after a backoff, up to
+// chunkRounds times. Providers that time out or send corrupt data are
+// skipped for a while, unless no other provider is left.
+func (dm *DownloadManager) fetchChunk(ctx context.Context, d *fileDownload, index int, chunk file.ChunkRecord) ([]byte, peer.ID, error) {
+	lastErr := errors.New("no remote provider to ask")
+	for round := 0; ; round++ {
+		tried := map[peer.ID]bool{dm.Host.ID(): true}
+		for attempts := 0; ; attempts++ {
+			providers := d.set.list()
+			var untried, skipped []peer.ID
+			for k := range providers {
+				p := providers[(index+k)%len(providers)]
+				if tried[p] {
+					continue
+				}
+				if d.bad.excluded(p) {
+					skipped = append(skipped, p)
+				} else {
+					untried = append(untried, p)
+				}
+			}
+			// Skipped providers are only asked when they are all that is
+			// left, rather than failing the chunk.
+			if len(untried) == 0 && attempts == 0 {
+				untried = skipped
+			}
+			if len(untried) == 0 {
+				break
+			}
+			provider, err := d.slots.acquire(ctx, untried)
+			if err != nil {
+				return nil, "", err
+			}
+			tried[provider] = true
+			if err := dm.scheduler().acquire(ctx, d.job); err != nil {
+				d.slots.release(provider)
+				return nil, "", err
+			}
+
+			fmt.Printf("Requesting chunk %d from remote peer %s...\n", index, provider)
+			data, err := dm.requestChunk(ctx, provider, chunk)
+			dm.scheduler().release(d.job)
+			d.slots.release(provider)
+			if err == nil {
+				return data, provider, nil
+			}
+			fmt.Printf("Chunk %d from %s failed: %v\n", index, provider, err)
+			if errors.Is(err, errTimeout) || errors.Is(err, errCorrupt) {
+				fmt.Printf("Skipping %s for %s\n", provider, d.bad.add(provider))
+			}
+			lastErr = err
+		}
+
+		if round+1 == chunkRounds {
+			return nil, "", fmt.Errorf("no provider could serve it after %d rounds: %w", chunkRounds, lastErr)
+		}
+		wait := backoff(round)
+		fmt.Printf("No provider could serve chunk %d, retrying in %s\n", index, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		}
+	}
+}
+
+// requestChunk fetches and verifies a chunk from one provider. Timeouts
+// and corrupt data are reported as errTimeout and errCorrupt.
+func (dm *DownloadManager) requestChunk(ctx context.Context, provider peer.ID, chunk file.ChunkRecord) ([]byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, chunkTimeout)
+	defer cancel()
+	data, err := p2p.RequestChunkByHash(reqCtx, dm.Host, provider, chunk.Hash)
 	if err != nil {
+		var netErr net.Error
+		if ctx.Err() == nil && (errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()) {
+			return nil, fmt.Errorf("%w: %v", errTimeout, err)
+		}
 		return nil, err
 	}
+	if len(data) == 0 {
+		return nil, errors.New("provider does not have the chunk")
+	}
+	if err := verifyChunk(chunk, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// verifyChunk checks data against its chunk record. The chunk hash names
+// its algorithm, so files indexed with any supported one, or by peers
+// still sending bare SHA-256 hex, verify.
+func verifyChunk(chunk file.ChunkRecord, data []byte) error {
+	if file.VerifyHash(chunk.Hash, data) != nil || int64(len(data)) != chunk.Length {
+		return errCorrupt
+	}
+	return nil
+}
+
+// complete reports whether path already holds the file meta describes.
+func complete(path string, meta file.FileMeta) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
 	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.Size() != meta.Size {
+		return false
+	}
+	return verifyFile(f, meta.FileHash) == nil
+}
 
-	offset := int64(chunkIndex) * file.ChunkSize
-	if _, err := f.Seek(offset, 0); err != nil {
-		return nil, err
+// verifyFile checks the whole of f against hash.
+func verifyFile(f *os.File, hash string) error {
+	v, err := file.NewVerifier(hash)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(v, io.NewSectionReader(f, 0, math.MaxInt64)); err != nil {
+		return err
+	}
+	return v.Verify()
+}
+
+// collection returns a collection manifest from the local index or the
+// first provider that sends one matching hash.
+func (dm *DownloadManager) collection(ctx context.Context, hash string, providers []peer.ID) (file.Collection, error) {
+	if _, coll, ok := dm.Index.LookupCollection(hash); ok {
+		return coll, nil
+	}
+	lastErr := errors.New("no remote provider to ask")
+	for _, provider := range providers {
+		if provider == dm.Host.ID() {
+			continue
+		}
+		coll, err := p2p.RequestCollection(ctx, dm.Host, provider, hash)
+		if err == nil {
+			return coll, nil
+		}
+		fmt.Printf("Collection from %s rejected: %v\n", provider, err)
+		lastErr = err
+	}
+	return file.Collection{}, fmt.Errorf("could not get collection %s: %w", hash, lastErr)
+}
+
+// chunkRecords returns the records of the chunks below Merkle node (level,
+// index), checked against the file's root. They come from the local index
+// when this node has the file, otherwise from the first provider that
+// sends a valid proof.
+func (dm *DownloadManager) chunkRecords(ctx context.Context, meta file.FileMeta, root string, providers []peer.ID, level, index int) ([]file.ChunkRecord, error) {
+	if local, ok := dm.Index.Lookup(meta.FileHash); ok {
+		tree, err := file.MerkleTreeFromHex(local.ChunkHashes())
+		if err == nil {
+			leaves, proof, err := tree.Subtree(level, index)
+			if err == nil && file.VerifySubtree(root, meta.NumChunks, level, index, leaves, proof) == nil {
+				start := index << level
+				return local.Chunks[start : start+len(leaves)], nil
+			}
+		}
 	}
 
-	buf := make([]byte, file.ChunkSize)
-	n, err := f.Read(buf)
-	if err != nil && err != io.EOF {
+	lastErr := errors.New("no remote provider to ask")
+	for _, provider := range providers {
+		if provider == dm.Host.ID() {
+			continue
+		}
+		chunks, proof, err := p2p.RequestProof(ctx, dm.Host, provider, meta.FileHash, level, index)
+		if err == nil {
+			err = verifyChunkRecords(root, meta.NumChunks, level, index, chunks, proof)
+		}
+		if err == nil {
+			return chunks, nil
+		}
+		fmt.Printf("Proof from %s rejected: %v\n", provider, err)
+		lastErr = err
+	}
+	return nil, fmt.Errorf("could not get verified chunk hashes for chunks from %d: %w", index<<level, lastErr)
+}
+
+// verifyChunkRecords checks the hashes of chunks against the Merkle root.
+// Offsets and lengths are not covered by the tree; each chunk's length is
+// checked when its data arrives, and each offset against the running total.
+// Chunk hashes must use the same algorithm as the root.
+func verifyChunkRecords(root string, numChunks, level, index int, chunks []file.ChunkRecord, proof [][]byte) error {
+	rootCode, _, err := file.DecodeHash(root)
+	if err != nil {
+		return err
+	}
+	leaves := make([][]byte, len(chunks))
+	for i, c := range chunks {
+		code, digest, err := file.DecodeHash(c.Hash)
+		if err != nil {
+			return fmt.Errorf("invalid chunk hash: %w", err)
+		}
+		if code != rootCode {
+			return fmt.Errorf("chunk hash %s does not use the root's algorithm", c.Hash)
+		}
+		leaves[i] = digest
+	}
+	return file.VerifySubtree(root, numChunks, level, index, leaves, proof)
+}
+
+// readLocalChunk reads a chunk from any local file that contains it.
+func (dm *DownloadManager) readLocalChunk(chunkHash string) ([]byte, error) {
+	localMeta, chunk, ok := dm.Index.LookupChunk(chunkHash)
+	if !ok {
+		return nil, fmt.Errorf("could not find local chunk %s", chunkHash)
+	}
+
+	f, err := os.Open(localMeta.Path)
+	if err != nil {
 		return nil, err
 	}
+	defer f.Close()
 
-	return buf[:n], nil
+	buf := make([]byte, chunk.Length)
+	if _, err := f.ReadAt(buf, chunk.Offset); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
 }
@@ -0,0 +1,30 @@
+package download
+
+import (
+	"testing"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+func TestCheckChunk(t *testing.T) {
+	meta := file.FileMeta{Size: 1 << 30}
+	tests := []struct {
+		chunk  file.ChunkRecord
+		offset int64
+		ok     bool
+	}{
+		{file.ChunkRecord{Offset: 0, Length: 60}, 0, true},
+		{file.ChunkRecord{Offset: 60, Length: file.MaxChunkSize}, 60, true},
+		{file.ChunkRecord{Offset: 50, Length: 40}, 60, false},
+		{file.ChunkRecord{Offset: 60, Length: 1<<30 - 59}, 60, false},
+		{file.ChunkRecord{Offset: 60, Length: file.MaxChunkSize + 1}, 60, false},
+		{file.ChunkRecord{Offset: 60, Length: 0}, 60, false},
+		{file.ChunkRecord{Offset: 60, Length: 1 << 40}, 60, false},
+	}
+	for _, tt := range tests {
+		err := checkChunk(meta, 1, tt.chunk, tt.offset)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkChunk(%+v at %d) = %v, expected ok=%v", tt.chunk, tt.offset, err, tt.ok)
+		}
+	}
+}
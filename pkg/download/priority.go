@@ -0,0 +1,169 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Priority orders download jobs. The zero value is PriorityNormal.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// ParsePriority parses low, normal or high; the empty string is normal.
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "low":
+		return PriorityLow, nil
+	case "normal", "":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return 0, fmt.Errorf("unknown priority %q, expected low, normal or high", s)
+}
+
+// String returns the name ParsePriority accepts for p.
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	}
+	return "normal"
+}
+
+func (p Priority) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Priority) UnmarshalText(text []byte) error {
+	parsed, err := ParsePriority(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// scheduler shares the chunk requests a DownloadManager has in flight
+// among its downloads. A freed slot goes to the waiting request of the
+// highest priority job, and between jobs of equal priority to the one with
+// the fewest requests in flight. A job only holds slots for requests it is
+// actually sending, so slots it cannot use, for lack of providers, go to
+// lower priorities. Priorities are strict, so a job waits for as long as
+// higher priority jobs use every slot.
+type scheduler struct {
+	limit int
+
+	mu       sync.Mutex
+	inflight int
+	// jobs counts the requests in flight per job; downloads outside the
+	// queue count under "".
+	jobs       map[string]int
+	priorities map[string]Priority
+	waiting    []*slotWaiter
+}
+
+type slotWaiter struct {
+	job   string
+	ready chan struct{}
+}
+
+func newScheduler(limit int) *scheduler {
+	return &scheduler{
+		limit:      limit,
+		jobs:       make(map[string]int),
+		priorities: make(map[string]Priority),
+	}
+}
+
+// acquire waits for a request slot for job.
+func (s *scheduler) acquire(ctx context.Context, job string) error {
+	s.mu.Lock()
+	if s.inflight < s.limit && len(s.waiting) == 0 {
+		s.grantLocked(job)
+		s.mu.Unlock()
+		return nil
+	}
+	w := &slotWaiter{job: job, ready: make(chan struct{})}
+	s.waiting = append(s.waiting, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.waiting {
+		if other == w {
+			s.waiting = append(s.waiting[:i], s.waiting[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// Granted while giving up; hand the slot on.
+	s.releaseLocked(job)
+	return ctx.Err()
+}
+
+func (s *scheduler) release(job string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releaseLocked(job)
+}
+
+// setPriority changes the priority of job, including for the requests it
+// is already waiting with.
+func (s *scheduler) setPriority(job string, p Priority) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.priorities[job] = p
+}
+
+// forget drops the priority of a job that has stopped.
+func (s *scheduler) forget(job string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.priorities, job)
+}
+
+func (s *scheduler) grantLocked(job string) {
+	s.inflight++
+	s.jobs[job]++
+}
+
+func (s *scheduler) releaseLocked(job string) {
+	s.inflight--
+	if s.jobs[job]--; s.jobs[job] == 0 {
+		delete(s.jobs, job)
+	}
+	for s.inflight < s.limit && len(s.waiting) > 0 {
+		best := 0
+		for i, w := range s.waiting[1:] {
+			if s.before(w.job, s.waiting[best].job) {
+				best = i + 1
+			}
+		}
+		w := s.waiting[best]
+		s.waiting = append(s.waiting[:best], s.waiting[best+1:]...)
+		s.grantLocked(w.job)
+		close(w.ready)
+	}
+}
+
+// before reports whether a waiting request of job a goes ahead of one of
+// job b.
+func (s *scheduler) before(a, b string) bool {
+	if pa, pb := s.priorities[a], s.priorities[b]; pa != pb {
+		return pa > pb
+	}
+	return s.jobs[a] < s.jobs[b]
+}
@@ -0,0 +1,120 @@
+package download
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPriorityJSON(t *testing.T) {
+	data, err := json.Marshal(Job{Priority: PriorityHigh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.Priority != PriorityHigh {
+		t.Errorf("Expected high priority to round-trip, got %s from %s", job.Priority, data)
+	}
+	if err := json.Unmarshal([]byte(`{"priority":"urgent"}`), &job); err == nil {
+		t.Error("Expected an unknown priority to be rejected")
+	}
+}
+
+func TestSchedulerPriorities(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s := newScheduler(1)
+	s.setPriority("low", PriorityLow)
+	s.setPriority("high", PriorityHigh)
+	if err := s.acquire(ctx, "low"); err != nil {
+		t.Fatal(err)
+	}
+
+	granted := make(chan string, 3)
+	wait := func(job string) {
+		go func() {
+			if s.acquire(ctx, job) == nil {
+				granted <- job
+			}
+		}()
+	}
+	waiting := func(n int) {
+		for {
+			s.mu.Lock()
+			got := len(s.waiting)
+			s.mu.Unlock()
+			if got == n {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait("low")
+	waiting(1)
+	wait("")
+	waiting(2)
+	wait("high")
+	waiting(3)
+
+	// A request given up on leaves the queue without taking a slot.
+	short, stop := context.WithCancel(ctx)
+	stop()
+	if err := s.acquire(short, "high"); err == nil {
+		t.Error("Expected acquire to fail once its context is done")
+	}
+
+	s.release("low")
+	if job := <-granted; job != "high" {
+		t.Fatalf("Expected the high priority job first, got %q", job)
+	}
+	// Raising a job's priority applies to the requests it is waiting with.
+	s.setPriority("low", PriorityHigh)
+	s.release("high")
+	if job := <-granted; job != "low" {
+		t.Fatalf("Expected the raised job next, got %q", job)
+	}
+	s.release("low")
+	if job := <-granted; job != "" {
+		t.Fatalf("Expected the normal priority download last, got %q", job)
+	}
+	s.release("")
+	if s.inflight != 0 || len(s.jobs) != 0 {
+		t.Errorf("Expected no requests in flight, got %d (%v)", s.inflight, s.jobs)
+	}
+}
+
+func TestSchedulerSharesEqualPriorities(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s := newScheduler(2)
+	for i := 0; i < 2; i++ {
+		if err := s.acquire(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	granted := make(chan string, 2)
+	for _, job := range []string{"a", "b"} {
+		go func() {
+			if s.acquire(ctx, job) == nil {
+				granted <- job
+			}
+		}()
+	}
+	for {
+		s.mu.Lock()
+		n := len(s.waiting)
+		s.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.release("a")
+	if job := <-granted; job != "b" {
+		t.Errorf("Expected the freed slot to go to the job with fewer in flight, got %q", job)
+	}
+}
@@ -0,0 +1,145 @@
+package download
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// progressInterval is how often a running download reports its progress.
+const progressInterval = 500 * time.Millisecond
+
+// rateWindow is how far back the rates of a download look, so they follow
+// changes in speed instead of averaging over the whole download.
+const rateWindow = 10 * time.Second
+
+// Progress is a snapshot of a file download, reported through
+// DownloadManager.OnProgress.
+type Progress struct {
+	// Job is the ID of the queued job the download belongs to, if any.
+	Job        string `json:"job,omitempty"`
+	FileHash   string `json:"file_hash"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	Done       int64  `json:"done"`
+	Chunks     int    `json:"chunks"`
+	ChunksDone int    `json:"chunks_done"`
+	// Rate is the speed, in bytes per second, of the chunks fetched from
+	// providers over the last rateWindow; ETA is the time left at that
+	// rate.
+	Rate      float64            `json:"rate"`
+	ETA       time.Duration      `json:"eta"`
+	Providers []ProviderProgress `json:"providers,omitempty"`
+	// Finished is set on the last report of a download, whether it
+	// succeeded or not.
+	Finished bool `json:"finished,omitempty"`
+}
+
+type ProviderProgress struct {
+	Peer   peer.ID `json:"peer"`
+	Chunks int     `json:"chunks"`
+	Bytes  int64   `json:"bytes"`
+	Rate   float64 `json:"rate"`
+}
+
+// progress counts what a download has done. Chunks that were already on
+// disk count towards Done but not towards the rates.
+type progress struct {
+	mu        sync.Mutex
+	report    Progress
+	start     time.Time
+	providers map[peer.ID]*ProviderProgress
+	// recent holds the chunks fetched within rateWindow, oldest first.
+	recent []fetched
+}
+
+type fetched struct {
+	at       time.Time
+	provider peer.ID
+	n        int64
+}
+
+func newProgress(job, name, hash string, size int64, chunks int) *progress {
+	return &progress{
+		report: Progress{
+			Job:      job,
+			FileHash: hash,
+			Name:     name,
+			Size:     size,
+			Chunks:   chunks,
+		},
+		start:     time.Now(),
+		providers: make(map[peer.ID]*ProviderProgress),
+	}
+}
+
+// add records a chunk of n bytes, fetched from provider or found locally
+// if provider is empty.
+func (p *progress) add(provider peer.ID, n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.report.Done += n
+	p.report.ChunksDone++
+	if provider == "" {
+		return
+	}
+	p.recent = append(p.recent, fetched{at: time.Now(), provider: provider, n: n})
+	pp := p.providers[provider]
+	if pp == nil {
+		pp = &ProviderProgress{Peer: provider}
+		p.providers[provider] = pp
+	}
+	pp.Chunks++
+	pp.Bytes += n
+}
+
+func (p *progress) snapshot() Progress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r := p.report
+	now := time.Now()
+	cutoff := now.Add(-rateWindow)
+	for len(p.recent) > 0 && p.recent[0].at.Before(cutoff) {
+		p.recent = p.recent[1:]
+	}
+	var total int64
+	perProvider := make(map[peer.ID]int64)
+	for _, f := range p.recent {
+		total += f.n
+		perProvider[f.provider] += f.n
+	}
+	window := min(now.Sub(p.start), rateWindow).Seconds()
+	if window > 0 {
+		r.Rate = float64(total) / window
+	}
+	if r.Rate > 0 {
+		r.ETA = time.Duration(float64(r.Size-r.Done) / r.Rate * float64(time.Second))
+	}
+	r.Providers = make([]ProviderProgress, 0, len(p.providers))
+	for _, pp := range p.providers {
+		s := *pp
+		if window > 0 {
+			s.Rate = float64(perProvider[s.Peer]) / window
+		}
+		r.Providers = append(r.Providers, s)
+	}
+	sort.Slice(r.Providers, func(i, j int) bool { return r.Providers[i].Bytes > r.Providers[j].Bytes })
+	return r
+}
+
+// reportProgress calls OnProgress every progressInterval until ctx is done.
+func (dm *DownloadManager) reportProgress(ctx context.Context, p *progress) {
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			dm.OnProgress(p.snapshot())
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package download
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestProgressSnapshot(t *testing.T) {
+	p := newProgress("job1", "file.bin", "hash", 400, 4)
+	p.start = time.Now().Add(-2 * time.Second)
+	p.add("", 100)
+	p.add(peer.ID("a"), 100)
+	p.add(peer.ID("b"), 50)
+	p.add(peer.ID("b"), 50)
+
+	s := p.snapshot()
+	if s.Job != "job1" {
+		t.Errorf("Expected job1, got %q", s.Job)
+	}
+	if s.Done != 300 || s.ChunksDone != 4 {
+		t.Errorf("Expected 300 bytes in 4 chunks, got %d in %d", s.Done, s.ChunksDone)
+	}
+	// Only the 200 fetched bytes count towards the rate.
+	if s.Rate < 90 || s.Rate > 100 {
+		t.Errorf("Expected a rate of about 100 B/s, got %f", s.Rate)
+	}
+	if s.ETA < 900*time.Millisecond || s.ETA > 1100*time.Millisecond {
+		t.Errorf("Expected an ETA of about 1s, got %s", s.ETA)
+	}
+	if len(s.Providers) != 2 {
+		t.Fatalf("Expected 2 providers, got %d", len(s.Providers))
+	}
+	for _, pp := range s.Providers {
+		want := 1
+		if pp.Peer == "b" {
+			want = 2
+		}
+		if pp.Bytes != 100 || pp.Chunks != want {
+			t.Errorf("Expected 100 bytes in %d chunks from %s, got %d in %d", want, pp.Peer, pp.Bytes, pp.Chunks)
+		}
+	}
+}
+
+func TestProgressRateWindow(t *testing.T) {
+	p := newProgress("", "file.bin", "hash", 10000, 3)
+	p.start = time.Now().Add(-time.Minute)
+	p.add(peer.ID("a"), 5000)
+	// Fetched long ago, so it no longer counts towards the rates.
+	p.recent[0].at = time.Now().Add(-30 * time.Second)
+	p.add(peer.ID("a"), 500)
+	p.add(peer.ID("b"), 500)
+
+	s := p.snapshot()
+	want := 1000 / rateWindow.Seconds()
+	if s.Rate < want*0.9 || s.Rate > want*1.1 {
+		t.Errorf("Expected a rate of about %.0f B/s, got %f", want, s.Rate)
+	}
+	if s.ETA < 36*time.Second || s.ETA > 44*time.Second {
+		t.Errorf("Expected an ETA of about 40s, got %s", s.ETA)
+	}
+	for _, pp := range s.Providers {
+		if pp.Rate < want/2*0.9 || pp.Rate > want/2*1.1 {
+			t.Errorf("Expected %s at about %.0f B/s, got %f", pp.Peer, want/2, pp.Rate)
+		}
+	}
+}
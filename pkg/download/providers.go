@@ -0,0 +1,197 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// maxDHTProviders caps how many providers are looked up for one hash.
+const maxDHTProviders = 20
+
+// providerRefresh is how often the providers of a running download are
+// looked up again.
+const providerRefresh = 30 * time.Second
+
+// FindProviders returns the peers that have hash: connected peers, which
+// includes mDNS neighbours, that answer a have query, and the providers
+// recorded in the DHT, connected to on the way.
+func (dm *DownloadManager) FindProviders(ctx context.Context, hash string) []peer.ID {
+	providers := dm.askPeers(ctx, dm.Host.Network().Peers(), hash)
+	if dm.DHT == nil {
+		return providers
+	}
+	infos, err := p2p.FindProviders(ctx, dm.DHT, hash, maxDHTProviders)
+	if err != nil {
+		fmt.Printf("DHT provider lookup failed: %v\n", err)
+	}
+	found := 0
+next:
+	for _, info := range infos {
+		for _, p := range providers {
+			if p == info.ID {
+				continue next
+			}
+		}
+		if err := dm.Host.Connect(ctx, info); err != nil {
+			fmt.Printf("Could not connect to provider %s: %v\n", info.ID, err)
+			continue
+		}
+		providers = append(providers, info.ID)
+		found++
+	}
+	if found > 0 {
+		fmt.Printf("Found %d more providers of %s in the DHT.\n", found, hash)
+	}
+	return providers
+}
+
+// askPeers sends a have query for hash to every peer at once and returns
+// those that have it.
+func (dm *DownloadManager) askPeers(ctx context.Context, peers []peer.ID, hash string) []peer.ID {
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		has []peer.ID
+	)
+	for _, p := range peers {
+		if p == dm.Host.ID() {
+			continue
+		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			if ok, err := p2p.RequestHave(ctx, dm.Host, p, hash); err == nil && ok {
+				mu.Lock()
+				has = append(has, p)
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	return has
+}
+
+// providerSet holds the providers of a download. It only grows: peers
+// found while the download runs are added and used for the chunks still
+// to come.
+type providerSet struct {
+	mu    sync.Mutex
+	peers []peer.ID
+}
+
+// add adds the peers not in the set yet and returns how many there were.
+func (s *providerSet) add(peers ...peer.ID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := 0
+next:
+	for _, p := range peers {
+		for _, known := range s.peers {
+			if p == known {
+				continue next
+			}
+		}
+		s.peers = append(s.peers, p)
+		added++
+	}
+	return added
+}
+
+func (s *providerSet) list() []peer.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]peer.ID(nil), s.peers...)
+}
+
+// track keeps set up to date until ctx is done: every newly connected peer
+// is asked whether it has hash, and the full lookup is repeated every
+// providerRefresh.
+func (dm *DownloadManager) track(ctx context.Context, hash string, set *providerSet) {
+	connected := make(chan peer.ID, 16)
+	notify := &network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			select {
+			case connected <- c.RemotePeer():
+			default:
+			}
+		},
+	}
+	dm.Host.Network().Notify(notify)
+	defer dm.Host.Network().StopNotify(notify)
+
+	ticker := time.NewTicker(providerRefresh)
+	defer ticker.Stop()
+	for {
+		var found []peer.ID
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-connected:
+			found = dm.askPeers(ctx, []peer.ID{p}, hash)
+		case <-ticker.C:
+			found = dm.FindProviders(ctx, hash)
+		}
+		if n := set.add(found...); n > 0 {
+			fmt.Printf("Added %d new providers of %s.\n", n, hash)
+		}
+	}
+}
+
+// peerSlots limits the chunk requests in flight to each provider.
+type peerSlots struct {
+	limit int
+	mu    sync.Mutex
+	busy  map[peer.ID]int
+	// freed is closed, and replaced, whenever a slot is released.
+	freed chan struct{}
+}
+
+func newPeerSlots(limit int) *peerSlots {
+	return &peerSlots{
+		limit: limit,
+		busy:  make(map[peer.ID]int),
+		freed: make(chan struct{}),
+	}
+}
+
+// acquire takes a slot on the least busy of providers, waiting for one to
+// be released if all of them are full. Ties go to the earliest provider.
+func (s *peerSlots) acquire(ctx context.Context, providers []peer.ID) (peer.ID, error) {
+	for {
+		s.mu.Lock()
+		best := -1
+		for i, p := range providers {
+			if s.busy[p] < s.limit && (best < 0 || s.busy[p] < s.busy[providers[best]]) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			p := providers[best]
+			s.busy[p]++
+			s.mu.Unlock()
+			return p, nil
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func (s *peerSlots) release(p peer.ID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy[p]--
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
@@ -0,0 +1,49 @@
+package download
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestPeerSlots(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	a, b := peer.ID("a"), peer.ID("b")
+	slots := newPeerSlots(2)
+
+	var got []peer.ID
+	for i := 0; i < 4; i++ {
+		p, err := slots.acquire(ctx, []peer.ID{a, b})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	if got[0] != a || got[1] != b || got[2] != a || got[3] != b {
+		t.Errorf("Expected slots to alternate between providers, got %v", got)
+	}
+
+	acquired := make(chan peer.ID)
+	go func() {
+		p, _ := slots.acquire(ctx, []peer.ID{a, b})
+		acquired <- p
+	}()
+	select {
+	case p := <-acquired:
+		t.Fatalf("Expected acquire to wait while all slots are busy, got %s", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+	slots.release(b)
+	if p := <-acquired; p != b {
+		t.Errorf("Expected the released slot of b, got %s", p)
+	}
+
+	short, stop := context.WithCancel(ctx)
+	stop()
+	if _, err := slots.acquire(short, []peer.ID{a}); err == nil {
+		t.Error("Expected acquire to fail once its context is done")
+	}
+}
@@ -0,0 +1,459 @@
+package download
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Job states. Jobs that were running when the daemon stopped are queued
+// again when it starts.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobPaused  = "paused"
+	JobDone    = "done"
+	JobFailed  = "failed"
+	// JobCanceled is the state a job is last reported in when it is
+	// removed from the queue.
+	JobCanceled = "canceled"
+)
+
+var ErrNoJob = errors.New("no such download job")
+
+// Job is a download run by a Queue: a file, or a whole collection if
+// Collection is set.
+type Job struct {
+	ID         string        `json:"id"`
+	Meta       file.FileMeta `json:"meta"`
+	Collection string        `json:"collection,omitempty"`
+	Providers  []peer.ID     `json:"providers,omitempty"`
+	SaveDir    string        `json:"save_dir"`
+	// Priority decides which queued job runs first and how chunk requests
+	// are shared between running jobs.
+	Priority Priority `json:"priority"`
+	State    string   `json:"state"`
+	Error    string   `json:"error,omitempty"`
+	// SavedTo is the file or directory the job saved, once it is done.
+	SavedTo string    `json:"saved_to,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Finished reports whether the job has stopped for good or until resumed.
+func (j Job) Finished() bool {
+	return j.State == JobDone || j.State == JobFailed || j.State == JobPaused
+}
+
+// Queue runs download jobs in the background, a few at a time, and keeps
+// them in a file so unfinished jobs carry on after a restart, resuming
+// from what their downloads had already written.
+type Queue struct {
+	dm      *DownloadManager
+	path    string
+	workers int
+	// OnChange, if set, is called with a copy of a job whenever it changes.
+	// It is called with the queue locked and must not call back into it.
+	OnChange func(Job)
+
+	mu      sync.Mutex
+	jobs    []*Job
+	cancels map[string]context.CancelFunc
+	// changed is closed, and replaced, whenever a job changes.
+	changed chan struct{}
+	// dirty is set when jobs changed since they were last saved.
+	dirty bool
+
+	// saveMu orders writes of the jobs file, which happen outside mu.
+	saveMu sync.Mutex
+}
+
+// maxFinishedJobs is how many done or failed jobs are kept; older ones
+// are dropped from the queue.
+const maxFinishedJobs = 100
+
+// NewQueue loads the jobs saved at path, if any, and returns a queue that
+// runs up to workers of them at once.
+func NewQueue(dm *DownloadManager, path string, workers int) (*Queue, error) {
+	q := &Queue{
+		dm:      dm,
+		path:    path,
+		workers: workers,
+		cancels: make(map[string]context.CancelFunc),
+		changed: make(chan struct{}),
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		dm.expireStates(nil)
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	keep := make(map[string]bool)
+	for _, job := range q.jobs {
+		if job.State == JobRunning {
+			job.State = JobQueued
+		}
+		if job.State != JobDone {
+			keep[job.ID] = true
+		}
+	}
+	dm.expireStates(keep)
+	return q, nil
+}
+
+// Run executes queued jobs until ctx is done. Jobs interrupted by that are
+// left queued.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job := q.next(ctx)
+				if job == nil {
+					return
+				}
+				q.run(ctx, job)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Add queues a new job and returns it with its ID and state filled in.
+func (q *Queue) Add(job Job) (Job, error) {
+	if job.Collection == "" && job.Meta.FileHash == "" {
+		return Job{}, errors.New("a job needs a file or a collection")
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+	job.ID = hex.EncodeToString(id)
+	job.State = JobQueued
+	job.Error = ""
+	job.SavedTo = ""
+	job.Created = time.Now()
+
+	defer q.flush()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.jobs = append(q.jobs, &job)
+	q.changedLocked(&job)
+	return job, nil
+}
+
+func (q *Queue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, len(q.jobs))
+	for i, job := range q.jobs {
+		jobs[i] = *job
+	}
+	return jobs
+}
+
+func (q *Queue) Job(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job := q.find(id); job != nil {
+		return *job, true
+	}
+	return Job{}, false
+}
+
+// Pause stops a queued or running job. Its download keeps what it has
+// written, so Resume carries on from there.
+func (q *Queue) Pause(id string) error {
+	defer q.flush()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.find(id)
+	if job == nil {
+		return ErrNoJob
+	}
+	if job.State != JobQueued && job.State != JobRunning {
+		return fmt.Errorf("job is %s", job.State)
+	}
+	job.State = JobPaused
+	if cancel := q.cancels[id]; cancel != nil {
+		cancel()
+	}
+	q.changedLocked(job)
+	return nil
+}
+
+// Resume queues a paused or failed job again.
+func (q *Queue) Resume(id string) error {
+	defer q.flush()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.find(id)
+	if job == nil {
+		return ErrNoJob
+	}
+	if job.State != JobPaused && job.State != JobFailed {
+		return fmt.Errorf("job is %s", job.State)
+	}
+	job.State = JobQueued
+	job.Error = ""
+	q.changedLocked(job)
+	return nil
+}
+
+// Cancel stops a job, removes it from the queue and deletes what its
+// downloads had written so far.
+func (q *Queue) Cancel(id string) error {
+	defer q.flush()
+	q.mu.Lock()
+	for i, job := range q.jobs {
+		if job.ID != id {
+			continue
+		}
+		cancel := q.cancels[id]
+		if cancel != nil {
+			cancel()
+		}
+		job.State = JobCanceled
+		q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+		q.changedLocked(job)
+		q.mu.Unlock()
+		// A running job cleans up once its download has stopped.
+		if cancel == nil {
+			q.dm.discardJob(id)
+		}
+		return nil
+	}
+	q.mu.Unlock()
+	return ErrNoJob
+}
+
+// SetPriority changes the priority of a job. A running job gets its new
+// share of chunk requests straight away.
+func (q *Queue) SetPriority(id string, p Priority) error {
+	defer q.flush()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := q.find(id)
+	if job == nil {
+		return ErrNoJob
+	}
+	job.Priority = p
+	if job.State == JobRunning {
+		q.dm.scheduler().setPriority(id, p)
+	}
+	q.changedLocked(job)
+	return nil
+}
+
+// Wait blocks until the job is finished or ctx is done, and returns it.
+func (q *Queue) Wait(ctx context.Context, id string) (Job, error) {
+	for {
+		q.mu.Lock()
+		found := q.find(id)
+		var job Job
+		if found != nil {
+			job = *found
+		}
+		changed := q.changed
+		q.mu.Unlock()
+		if found == nil {
+			return Job{}, ErrNoJob
+		}
+		if job.Finished() {
+			return job, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return job, ctx.Err()
+		}
+	}
+}
+
+// next marks the queued job of highest priority, the oldest among equals,
+// as running and returns it, waiting for one if there is none. It returns
+// nil once ctx is done.
+func (q *Queue) next(ctx context.Context) *Job {
+	for ctx.Err() == nil {
+		q.mu.Lock()
+		var next *Job
+		for _, job := range q.jobs {
+			// A job resumed right after a pause may still be winding down
+			// its previous run.
+			if job.State == JobQueued && q.cancels[job.ID] == nil && (next == nil || job.Priority > next.Priority) {
+				next = job
+			}
+		}
+		if next != nil {
+			next.State = JobRunning
+			q.changedLocked(next)
+			q.mu.Unlock()
+			q.flush()
+			return next
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+	return nil
+}
+
+func (q *Queue) run(ctx context.Context, job *Job) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	q.mu.Lock()
+	if job.State != JobRunning {
+		// Paused or canceled before it started.
+		q.mu.Unlock()
+		return
+	}
+	q.cancels[job.ID] = cancel
+	q.dm.scheduler().setPriority(job.ID, job.Priority)
+	j := *job
+	q.mu.Unlock()
+
+	var savedTo string
+	var err error
+	if j.Collection != "" {
+		fmt.Printf("Job %s: downloading collection %s\n", j.ID, j.Collection)
+		savedTo, err = q.dm.downloadCollection(jobCtx, j.ID, j.Collection, j.Providers, j.SaveDir)
+	} else {
+		fmt.Printf("Job %s: downloading '%s'\n", j.ID, j.Meta.Name)
+		savedTo = filepath.Join(j.SaveDir, saveName(j.Meta))
+		err = q.dm.downloadFile(jobCtx, j.ID, j.Meta, j.Providers, savedTo)
+	}
+
+	q.mu.Lock()
+	delete(q.cancels, j.ID)
+	q.dm.scheduler().forget(j.ID)
+	if job.State != JobRunning {
+		canceled := job.State == JobCanceled
+		q.wakeLocked()
+		q.mu.Unlock()
+		if canceled {
+			q.dm.discardJob(j.ID)
+		}
+		return
+	}
+	defer q.flush()
+	defer q.mu.Unlock()
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// The queue is stopping; the job runs again next time.
+		job.State = JobQueued
+	case err != nil:
+		job.State = JobFailed
+		job.Error = err.Error()
+	default:
+		job.State = JobDone
+		job.SavedTo = savedTo
+	}
+	fmt.Printf("Job %s: %s\n", j.ID, job.State)
+	q.changedLocked(job)
+}
+
+func (q *Queue) find(id string) *Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+// changedLocked marks the queue to be saved by the next flush and tells
+// waiters and OnChange that job changed.
+func (q *Queue) changedLocked(job *Job) {
+	if job.State == JobDone || job.State == JobFailed {
+		q.pruneLocked(job)
+	}
+	q.dirty = true
+	q.wakeLocked()
+	if q.OnChange != nil {
+		q.OnChange(*job)
+	}
+}
+
+func (q *Queue) wakeLocked() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// pruneLocked drops the oldest done or failed jobs beyond
+// maxFinishedJobs, other than the one that just finished.
+func (q *Queue) pruneLocked(finishedNow *Job) {
+	finished := 0
+	for _, job := range q.jobs {
+		if job.State == JobDone || job.State == JobFailed {
+			finished++
+		}
+	}
+	q.jobs = slices.DeleteFunc(q.jobs, func(job *Job) bool {
+		if finished > maxFinishedJobs && job != finishedNow && (job.State == JobDone || job.State == JobFailed) {
+			finished--
+			return true
+		}
+		return false
+	})
+}
+
+// flush saves the jobs if they changed. The jobs are copied under mu but
+// written after it is released, and changes made while a write is under
+// way are saved together by the next one.
+func (q *Queue) flush() {
+	q.saveMu.Lock()
+	defer q.saveMu.Unlock()
+	q.mu.Lock()
+	if !q.dirty || q.path == "" {
+		q.mu.Unlock()
+		return
+	}
+	q.dirty = false
+	data, err := json.MarshalIndent(q.jobs, "", "  ")
+	q.mu.Unlock()
+	if err == nil {
+		err = q.write(data)
+	}
+	if err != nil {
+		fmt.Printf("Failed to save download jobs: %v\n", err)
+	}
+}
+
+func (q *Queue) write(data []byte) error {
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// saveName returns the name a file is saved under: its own name reduced to
+// a single path element, or its hash if that leaves nothing usable.
+func saveName(meta file.FileMeta) string {
+	name := filepath.Base(meta.Name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		return file.NormalizeHash(meta.FileHash)
+	}
+	return name
+}
@@ -0,0 +1,208 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+func TestQueueStatesPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := NewQueue(&DownloadManager{}, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Add(Job{}); err == nil {
+		t.Error("Expected a job without a file or collection to be rejected")
+	}
+	first, err := q.Add(Job{Meta: file.FileMeta{Name: "a.bin", FileHash: "1220aa"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := q.Add(Job{Collection: "1220bb"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := q.Add(Job{Meta: file.FileMeta{Name: "c.bin", FileHash: "1220cc"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.ID == second.ID || first.State != JobQueued {
+		t.Fatalf("Expected distinct queued jobs, got %+v and %+v", first, second)
+	}
+
+	if err := q.Pause(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Resume(first.ID); err == nil {
+		t.Error("Expected resuming a queued job to fail")
+	}
+	if err := q.Cancel(third.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Cancel(third.ID); !errors.Is(err, ErrNoJob) {
+		t.Errorf("Expected ErrNoJob for a canceled job, got %v", err)
+	}
+	// A job running when the daemon stops is queued again on restart.
+	q.mu.Lock()
+	q.find(first.ID).State = JobRunning
+	q.dirty = true
+	q.mu.Unlock()
+	q.flush()
+
+	loaded, err := NewQueue(&DownloadManager{}, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := loaded.Jobs()
+	if len(jobs) != 2 {
+		t.Fatalf("Expected 2 saved jobs, got %d", len(jobs))
+	}
+	if jobs[0].ID != first.ID || jobs[0].State != JobQueued {
+		t.Errorf("Expected the running job to be queued again, got %+v", jobs[0])
+	}
+	if jobs[1].ID != second.ID || jobs[1].State != JobPaused || jobs[1].Collection != "1220bb" {
+		t.Errorf("Expected the paused collection job, got %+v", jobs[1])
+	}
+}
+
+func TestQueuePriorities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := NewQueue(&DownloadManager{Concurrency: 1}, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	low, err := q.Add(Job{Meta: file.FileMeta{Name: "a.bin", FileHash: "1220aa"}, Priority: PriorityLow})
+	if err != nil {
+		t.Fatal(err)
+	}
+	normal, err := q.Add(Job{Meta: file.FileMeta{Name: "b.bin", FileHash: "1220bb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SetPriority(low.ID, PriorityHigh); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.SetPriority("missing", PriorityHigh); !errors.Is(err, ErrNoJob) {
+		t.Errorf("Expected ErrNoJob, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if job := q.next(ctx); job == nil || job.ID != low.ID {
+		t.Fatalf("Expected the raised job to run first, got %+v", job)
+	}
+	if job := q.next(ctx); job == nil || job.ID != normal.ID {
+		t.Fatalf("Expected the normal job next, got %+v", job)
+	}
+
+	loaded, err := NewQueue(&DownloadManager{}, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := loaded.Job(low.ID); job.Priority != PriorityHigh {
+		t.Errorf("Expected the new priority to be saved, got %s", job.Priority)
+	}
+}
+
+func TestQueueRemovesStaleDownloads(t *testing.T) {
+	dir := t.TempDir()
+	dm := &DownloadManager{StateDir: filepath.Join(dir, "downloads")}
+	// writeState leaves a partial download behind as an interrupted one
+	// would, and returns its .part file.
+	writeState := func(hash, job string, age time.Duration) string {
+		part := filepath.Join(dir, hash+PartSuffix)
+		if err := os.WriteFile(part, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s := &downloadState{FileHash: hash, Part: part, Job: job, path: filepath.Join(dm.StateDir, hash+".state")}
+		if err := s.save(); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-age)
+		os.Chtimes(s.path, old, old)
+		return part
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	path := filepath.Join(dir, "jobs.json")
+	q, err := NewQueue(dm, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	paused, err := q.Add(Job{Meta: file.FileMeta{Name: "a.bin", FileHash: "aa"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := q.Add(Job{Meta: file.FileMeta{Name: "b.bin", FileHash: "bb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range []Job{paused, canceled} {
+		if err := q.Pause(job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pausedPart := writeState("aa", paused.ID, 0)
+	canceledPart := writeState("bb", canceled.ID, 0)
+	if err := q.Cancel(canceled.ID); err != nil {
+		t.Fatal(err)
+	}
+	if exists(canceledPart) || exists(filepath.Join(dm.StateDir, "bb.state")) {
+		t.Error("Expected a canceled job to leave no partial download")
+	}
+
+	orphanPart := writeState("cc", "gone", 0)
+	oldPart := writeState("dd", "", stateMaxAge+time.Hour)
+	recentPart := writeState("ee", "", time.Hour)
+	if _, err := NewQueue(dm, path, 1); err != nil {
+		t.Fatal(err)
+	}
+	if !exists(pausedPart) || !exists(recentPart) {
+		t.Error("Expected the paused job and a recent download to be kept")
+	}
+	if exists(orphanPart) || exists(oldPart) {
+		t.Error("Expected downloads of unknown jobs and old ones to be removed")
+	}
+}
+
+func TestQueueKeepsRecentFinishedJobs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	q, err := NewQueue(&DownloadManager{}, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first Job
+	for i := 0; i < maxFinishedJobs+5; i++ {
+		job, err := q.Add(Job{Meta: file.FileMeta{Name: "a.bin", FileHash: "aa"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = job
+			continue
+		}
+		q.mu.Lock()
+		q.find(job.ID).State = JobDone
+		q.changedLocked(q.find(job.ID))
+		q.mu.Unlock()
+	}
+	q.flush()
+	// The first job is still queued, so it is never dropped.
+	loaded, err := NewQueue(&DownloadManager{}, path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobs := loaded.Jobs()
+	if len(jobs) != maxFinishedJobs+1 || jobs[0].ID != first.ID {
+		t.Errorf("Expected the queued job and %d finished ones, got %d jobs", maxFinishedJobs, len(jobs))
+	}
+}
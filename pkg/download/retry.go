@@ -0,0 +1,79 @@
+package download
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+const (
+	// chunkTimeout bounds a single chunk request, so a stalled provider is
+	// given up on.
+	chunkTimeout = 2 * time.Minute
+	// chunkRounds is how many times every provider is tried for a chunk
+	// before the download fails.
+	chunkRounds = 5
+	// retryBase is the backoff after the first failed round; it doubles
+	// with every further round, up to retryMax.
+	retryBase = 500 * time.Millisecond
+	retryMax  = 30 * time.Second
+	// excludeBase is how long a provider that timed out or sent corrupt
+	// data is skipped; it doubles with every further strike, up to
+	// excludeMax.
+	excludeBase = 10 * time.Second
+	excludeMax  = 5 * time.Minute
+)
+
+var (
+	errTimeout = errors.New("request timed out")
+	errCorrupt = errors.New("verification failed! Corrupted data")
+)
+
+// backoff returns the wait before round+1, with up to 50% jitter either
+// way so that workers retrying at once do not hit the providers together.
+func backoff(round int) time.Duration {
+	d := retryMax
+	if round < 16 {
+		d = min(retryBase<<round, retryMax)
+	}
+	return d/2 + rand.N(d)
+}
+
+// strikes tracks the providers of a download that timed out or sent
+// corrupt data, and keeps them out of the rotation for a while.
+type strikes struct {
+	mu    sync.Mutex
+	count map[peer.ID]int
+	until map[peer.ID]time.Time
+}
+
+// add records a strike against p and returns how long it is skipped for.
+// Failures of requests that were already in flight when p was excluded
+// do not count again.
+func (s *strikes) add(p peer.ID) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.count == nil {
+		s.count = make(map[peer.ID]int)
+		s.until = make(map[peer.ID]time.Time)
+	}
+	if left := time.Until(s.until[p]); left > 0 {
+		return left
+	}
+	d := excludeMax
+	if n := s.count[p]; n < 16 {
+		d = min(excludeBase<<n, excludeMax)
+	}
+	s.count[p]++
+	s.until[p] = time.Now().Add(d)
+	return d
+}
+
+func (s *strikes) excluded(p peer.ID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Now().Before(s.until[p])
+}
@@ -0,0 +1,51 @@
+package download
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func TestBackoff(t *testing.T) {
+	for round, want := range []time.Duration{retryBase, 2 * retryBase, 4 * retryBase} {
+		for i := 0; i < 100; i++ {
+			if d := backoff(round); d < want/2 || d >= want*3/2 {
+				t.Fatalf("backoff(%d) = %s, expected %s ± 50%%", round, d, want)
+			}
+		}
+	}
+	if d := backoff(100); d >= retryMax*3/2 {
+		t.Errorf("backoff(100) = %s, expected at most %s", d, retryMax*3/2)
+	}
+}
+
+func TestStrikes(t *testing.T) {
+	var bad strikes
+	p := peer.ID("slow")
+	if bad.excluded(p) {
+		t.Fatal("Expected a provider without strikes to be used")
+	}
+	if d := bad.add(p); d != excludeBase {
+		t.Errorf("Expected the first strike to exclude for %s, got %s", excludeBase, d)
+	}
+	if d := bad.add(p); d > excludeBase {
+		t.Errorf("Expected a strike during exclusion not to extend it, got %s", d)
+	}
+	expire := func() { bad.until[p] = time.Now() }
+	expire()
+	if d := bad.add(p); d != 2*excludeBase {
+		t.Errorf("Expected the second strike to exclude for %s, got %s", 2*excludeBase, d)
+	}
+	for i := 0; i < 20; i++ {
+		expire()
+		bad.add(p)
+	}
+	expire()
+	if d := bad.add(p); d != excludeMax {
+		t.Errorf("Expected exclusion to be capped at %s, got %s", excludeMax, d)
+	}
+	if !bad.excluded(p) || bad.excluded(peer.ID("other")) {
+		t.Error("Expected only the struck provider to be excluded")
+	}
+}
@@ -0,0 +1,207 @@
+package download
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+// PartSuffix is appended to the save path of a file while it downloads.
+const PartSuffix = ".part"
+
+// stateSaveInterval is how often the state of a running download is
+// written out. Chunks written since the last save are fetched again after
+// a crash, and chunks saved as done are verified again on resume, so the
+// state never needs to be synced with the data.
+const stateSaveInterval = time.Second
+
+// stateMaxAge is how long the state and .part file of a download started
+// outside the queue are kept unused before they are removed.
+const stateMaxAge = 7 * 24 * time.Hour
+
+// downloadState records which chunks of a download have been written to
+// its .part file, so a download of the same hash picks up where the last
+// one stopped, even after a restart.
+type downloadState struct {
+	FileHash   string
+	MerkleRoot string
+	Size       int64
+	NumChunks  int
+	Part       string
+	// Job is the queued job the download belongs to, if any.
+	Job string `json:",omitempty"`
+	// Done has bit i set once chunk i is written.
+	Done []byte
+
+	// path is where the state is saved; empty keeps it in memory only.
+	path  string
+	mu    sync.Mutex
+	saved time.Time
+}
+
+// loadState returns the saved state of a download of meta, or a new one
+// if there is none or it was made for different metadata.
+func (dm *DownloadManager) loadState(meta file.FileMeta) *downloadState {
+	fresh := &downloadState{
+		FileHash:   meta.FileHash,
+		MerkleRoot: meta.MerkleRoot,
+		Size:       meta.Size,
+		NumChunks:  meta.NumChunks,
+		Done:       make([]byte, (meta.NumChunks+7)/8),
+	}
+	if dm.StateDir == "" {
+		return fresh
+	}
+	fresh.path = filepath.Join(dm.StateDir, file.NormalizeHash(meta.FileHash)+".state")
+
+	data, err := os.ReadFile(fresh.path)
+	if err != nil {
+		return fresh
+	}
+	var s downloadState
+	if err := json.Unmarshal(data, &s); err != nil {
+		fmt.Printf("Ignoring unreadable download state %s: %v\n", fresh.path, err)
+		return fresh
+	}
+	if s.MerkleRoot != meta.MerkleRoot || s.Size != meta.Size || s.NumChunks != meta.NumChunks || len(s.Done) != len(fresh.Done) {
+		return fresh
+	}
+	s.FileHash = meta.FileHash
+	s.path = fresh.path
+	return &s
+}
+
+// count returns how many chunks are done.
+func (s *downloadState) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for i := 0; i < s.NumChunks; i++ {
+		if s.Done[i/8]&(1<<(i%8)) != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *downloadState) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.Done)
+}
+
+func (s *downloadState) done(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Done[i/8]&(1<<(i%8)) != 0
+}
+
+// mark records chunk i as done, saving the state if it has not been saved
+// for stateSaveInterval.
+func (s *downloadState) mark(i int) {
+	s.mu.Lock()
+	s.Done[i/8] |= 1 << (i % 8)
+	due := time.Since(s.saved) >= stateSaveInterval
+	s.mu.Unlock()
+	if due {
+		if err := s.save(); err != nil {
+			fmt.Printf("Failed to save download state: %v\n", err)
+		}
+	}
+}
+
+func (s *downloadState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	s.saved = time.Now()
+	return os.Rename(tmp, s.path)
+}
+
+func (s *downloadState) remove() {
+	if s.path == "" {
+		return
+	}
+	if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Failed to remove download state: %v\n", err)
+	}
+}
+
+// discardJob removes the state and .part files of the downloads of a job,
+// except those still running.
+func (dm *DownloadManager) discardJob(id string) {
+	dm.removeStates(func(s *downloadState, _ os.FileInfo) bool {
+		return s.Job == id
+	})
+}
+
+// expireStates removes the state and .part files of downloads that belong
+// to none of the jobs listed in keep, or to no job and have not been used
+// for stateMaxAge.
+func (dm *DownloadManager) expireStates(keep map[string]bool) {
+	dm.removeStates(func(s *downloadState, info os.FileInfo) bool {
+		if s.Job != "" {
+			return !keep[s.Job]
+		}
+		return time.Since(info.ModTime()) > stateMaxAge
+	})
+}
+
+func (dm *DownloadManager) removeStates(match func(*downloadState, os.FileInfo) bool) {
+	if dm.StateDir == "" {
+		return
+	}
+	entries, err := os.ReadDir(dm.StateDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) != ".state" {
+			continue
+		}
+		path := filepath.Join(dm.StateDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var s downloadState
+		if err := json.Unmarshal(data, &s); err != nil || !match(&s, info) {
+			continue
+		}
+		if !dm.begin(s.FileHash) {
+			// Running again, under another job or outside the queue.
+			continue
+		}
+		if s.Part != "" {
+			if err := os.Remove(s.Part); err != nil && !errors.Is(err, os.ErrNotExist) {
+				fmt.Printf("Failed to remove %s: %v\n", s.Part, err)
+			}
+		}
+		s.path = path
+		s.remove()
+		dm.end(s.FileHash)
+	}
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type Event struct {
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Data any       `json:"data"`
+}
+
+// Bus fans events out to any number of subscribers. Publishing never
+// blocks: a subscriber that falls behind misses events rather than
+// stalling the publisher.
+type Bus struct {
+	mu   sync.Mutex
+	subs map[chan Event]string
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan Event]string)}
+}
+
+func (b *Bus) Publish(typ string, data any) {
+	ev := Event{Type: typ, Time: time.Now(), Data: data}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch, prefix := range b.subs {
+		if !strings.HasPrefix(typ, prefix) {
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event whose type starts with
+// prefix, and a function that ends the subscription.
+func (b *Bus) Subscribe(prefix string) (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	b.mu.Lock()
+	b.subs[ch] = prefix
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"math/bits"
+)
+
+// Content-defined chunking (FastCDC). A chunk ends where a rolling gear
+// hash of the last bytes matches a mask, so boundaries move with the
+// content: inserting a byte near the start of a file only changes the
+// chunks around the insertion instead of every chunk after it.
+
+// cdcParams are the boundaries for one average chunk size. Chunks are at
+// least a quarter and at most four times the average, but never larger than
+// MaxChunkSize, as a chunk is held in memory whole when it is sent or
+// received.
+type cdcParams struct {
+	minSize, avgSize, maxSize int
+	// Normalized chunking: a stricter mask before the average size and a
+	// looser one after it keep chunk sizes close to avgSize. The gear hash
+	// is shifted left, so its high bits depend on the most bytes.
+	maskStrict, maskLoose uint64
+}
+
+// newCDCParams returns the parameters for avgSize, a power of two.
+func newCDCParams(avgSize int64) cdcParams {
+	avgBits := bits.Len64(uint64(avgSize)) - 1
+	return cdcParams{
+		minSize:    int(avgSize / 4),
+		avgSize:    int(avgSize),
+		maxSize:    int(min(avgSize*4, MaxChunkSize)),
+		maskStrict: highBits(avgBits + 1),
+		maskLoose:  highBits(avgBits - 1),
+	}
+}
+
+// highBits returns a mask of the n most significant bits.
+func highBits(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// gear maps each byte to a fixed pseudo-random value. It must be identical
+// on every node, so it is derived from a constant seed.
+var gear = func() (table [256]uint64) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range table {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// cut returns the length of the chunk at the start of data. data holds at
+// least maxSize bytes unless it is the end of the file.
+func (p cdcParams) cut(data []byte) int {
+	n := len(data)
+	if n <= p.minSize {
+		return n
+	}
+	n = min(n, p.maxSize)
+	normal := min(n, p.avgSize)
+
+	var fp uint64
+	i := p.minSize
+	for ; i < normal; i++ {
+		fp = fp<<1 + gear[data[i]]
+		if fp&p.maskStrict == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = fp<<1 + gear[data[i]]
+		if fp&p.maskLoose == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// split calls fn with each content-defined chunk of r in order. The slice
+// passed to fn is only valid until fn returns.
+func (p cdcParams) split(r io.Reader, fn func(chunk []byte) error) error {
+	buf := make([]byte, p.maxSize)
+	n := 0
+	eof := false
+	for {
+		if !eof {
+			m, err := io.ReadFull(r, buf[n:])
+			n += m
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		cut := p.cut(buf[:n])
+		if err := fn(buf[:cut]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[cut:n])
+	}
+}
@@ -0,0 +1,85 @@
+package file
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func cdcChunks(t *testing.T, data []byte) []ChunkRecord {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := NewHasher(1, 0).HashFile(path, info, ChunkingCDC, ChunkSize, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return meta.Chunks
+}
+
+func TestCDCSurvivesInsertion(t *testing.T) {
+	data := make([]byte, 24*1024*1024)
+	rand.New(rand.NewSource(7)).Read(data)
+
+	before := cdcChunks(t, data)
+	after := cdcChunks(t, append([]byte("one extra line\n"), data...))
+
+	var offset int64
+	for i, c := range before {
+		if c.Offset != offset {
+			t.Fatalf("Chunk %d starts at %d, expected %d", i, c.Offset, offset)
+		}
+		if c.Length > 4*ChunkSize || (c.Length < ChunkSize/4 && i != len(before)-1) {
+			t.Errorf("Chunk %d has out of range length %d", i, c.Length)
+		}
+		offset += c.Length
+	}
+	if offset != int64(len(data)) {
+		t.Errorf("Chunks cover %d bytes, expected %d", offset, len(data))
+	}
+
+	known := make(map[string]bool)
+	for _, c := range before {
+		known[c.Hash] = true
+	}
+	shared := 0
+	for _, c := range after {
+		if known[c.Hash] {
+			shared++
+		}
+	}
+	if shared < len(before)-2 {
+		t.Errorf("Expected all but the first chunk to be reused, %d of %d were", shared, len(before))
+	}
+}
+
+func TestCDCSplitSmallInput(t *testing.T) {
+	var got [][]byte
+	err := newCDCParams(ChunkSize).split(bytes.NewReader([]byte("tiny")), func(chunk []byte) error {
+		got = append(got, append([]byte(nil), chunk...))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || string(got[0]) != "tiny" {
+		t.Errorf("Expected a single chunk, got %q", got)
+	}
+}
+
+func TestCDCMaxChunkSize(t *testing.T) {
+	if p := newCDCParams(MaxChunkSize); p.maxSize != MaxChunkSize {
+		t.Errorf("Expected chunks of at most %d bytes, got %d", MaxChunkSize, p.maxSize)
+	}
+	if p := newCDCParams(ChunkSize); p.maxSize != 4*ChunkSize {
+		t.Errorf("Expected chunks of at most %d bytes, got %d", 4*ChunkSize, p.maxSize)
+	}
+}
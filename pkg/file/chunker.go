@@ -2,11 +2,9 @@ package file
 
 import "io"
 
-const chunkSize = 1024 * 1024
-
 func Chunk(r io.Reader) ([][]byte, error) {
 	var chunks [][]byte
-	buf := make([]byte, chunkSize)
+	buf := make([]byte, ChunkSize)
 
 	for {
 		n, err := r.Read(buf)
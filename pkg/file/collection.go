@@ -0,0 +1,183 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Collection is the manifest of a directory: every file below it with its
+// slash-separated path relative to the directory. A collection is addressed
+// by the hash of its encoding, so the manifest a peer sends can be checked
+// against the hash that was asked for, and through it every file in it.
+type Collection struct {
+	Name    string
+	Entries []CollectionEntry
+}
+
+// CollectionEntry holds what a downloader needs to fetch and verify one
+// file of a collection.
+type CollectionEntry struct {
+	Path       string
+	Size       int64
+	FileHash   string
+	MerkleRoot string
+	NumChunks  int
+}
+
+// Encode returns the bytes a collection's hash is computed over.
+func (c Collection) Encode() []byte {
+	// Marshaling a struct with sorted entries is deterministic, and the
+	// fields cannot fail to encode.
+	data, _ := json.Marshal(c)
+	return data
+}
+
+// Hash returns the collection's hash, made with the algorithm of its first
+// file so a share's collections use the same one as its files.
+func (c Collection) Hash() (string, error) {
+	if len(c.Entries) == 0 {
+		return "", errors.New("collection is empty")
+	}
+	code, _, err := DecodeHash(c.Entries[0].FileHash)
+	if err != nil {
+		return "", err
+	}
+	h, err := newHash(code)
+	if err != nil {
+		return "", err
+	}
+	h.Write(c.Encode())
+	return encodeHash(code, h.Sum(nil)), nil
+}
+
+// DecodeCollection parses an encoded collection after checking it against
+// hash, and rejects entry paths that would leave the directory it is saved
+// to.
+func DecodeCollection(hash string, data []byte) (Collection, error) {
+	var c Collection
+	if err := VerifyHash(hash, data); err != nil {
+		return c, fmt.Errorf("collection %s: %w", hash, err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid collection: %w", err)
+	}
+	if !validEntryPath(c.Name) || strings.Contains(c.Name, "/") {
+		return c, fmt.Errorf("invalid collection name %q", c.Name)
+	}
+	for _, e := range c.Entries {
+		if !validEntryPath(e.Path) {
+			return c, fmt.Errorf("invalid path %q in collection", e.Path)
+		}
+	}
+	return c, nil
+}
+
+func validEntryPath(p string) bool {
+	return p != "" && p != "." && path.Clean(p) == p && !path.IsAbs(p) &&
+		p != ".." && !strings.HasPrefix(p, "../") && !strings.Contains(p, `\`)
+}
+
+// Meta returns the file metadata of an entry, enough to download it.
+func (e CollectionEntry) Meta() FileMeta {
+	return FileMeta{
+		Name:       path.Base(e.Path),
+		Size:       e.Size,
+		FileHash:   e.FileHash,
+		MerkleRoot: e.MerkleRoot,
+		NumChunks:  e.NumChunks,
+	}
+}
+
+// collectionSet holds the collections of every directory of an index
+// snapshot. Building it hashes a manifest per directory, so it is only done
+// when a collection is first asked for.
+type collectionSet struct {
+	files []FileMeta
+	once  sync.Once
+	// dirs[i] describes the directory whose manifest is colls[i].
+	dirs   []FileMeta
+	colls  []Collection
+	byHash map[string][]int
+}
+
+func (cs *collectionSet) get() *collectionSet {
+	cs.once.Do(cs.build)
+	return cs
+}
+
+// build groups the files of each share under every directory containing
+// them. Files indexed outside a share have no relative path and are left
+// out.
+func (cs *collectionSet) build() {
+	type dirKey struct{ share, rel string }
+	dirs := make(map[dirKey]*FileMeta)
+	colls := make(map[dirKey]*Collection)
+	for _, f := range cs.files {
+		if f.Share == "" || f.RelPath == "" {
+			continue
+		}
+		root := strings.TrimSuffix(f.Path, filepath.FromSlash(f.RelPath))
+		for dir := path.Dir(f.RelPath); ; dir = path.Dir(dir) {
+			key := dirKey{f.Share, dir}
+			if dirs[key] == nil {
+				name := path.Base(dir)
+				if dir == "." {
+					name = f.Share
+				}
+				dirs[key] = &FileMeta{
+					Name:    name,
+					Path:    filepath.Clean(filepath.Join(root, filepath.FromSlash(dir))),
+					Share:   f.Share,
+					RelPath: dir,
+					IsDir:   true,
+				}
+				colls[key] = &Collection{Name: name}
+			}
+			rel := f.RelPath
+			if dir != "." {
+				rel = strings.TrimPrefix(rel, dir+"/")
+			}
+			dirs[key].Size += f.Size
+			colls[key].Entries = append(colls[key].Entries, CollectionEntry{
+				Path:       rel,
+				Size:       f.Size,
+				FileHash:   f.FileHash,
+				MerkleRoot: f.MerkleRoot,
+				NumChunks:  f.NumChunks,
+			})
+			if dir == "." {
+				break
+			}
+		}
+	}
+
+	keys := make([]dirKey, 0, len(dirs))
+	for key := range dirs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].share != keys[j].share {
+			return keys[i].share < keys[j].share
+		}
+		return keys[i].rel < keys[j].rel
+	})
+	cs.byHash = make(map[string][]int, len(dirs))
+	for _, key := range keys {
+		dir, c := dirs[key], colls[key]
+		sort.Slice(c.Entries, func(i, j int) bool { return c.Entries[i].Path < c.Entries[j].Path })
+		hash, err := c.Hash()
+		if err != nil {
+			continue
+		}
+		dir.FileHash = hash
+		cs.byHash[hash] = append(cs.byHash[hash], len(cs.dirs))
+		cs.dirs = append(cs.dirs, *dir)
+		cs.colls = append(cs.colls, *c)
+	}
+}
@@ -0,0 +1,50 @@
+package file
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollectionsOfEveryDirectory(t *testing.T) {
+	hash := func(s string) string {
+		return encodeHash(hashCodes[HashSHA256], []byte(strings.Repeat(s, 32)))
+	}
+	idx := NewIndex([]FileMeta{
+		{Name: "a.txt", Path: "/srv/share/a.txt", Share: "docs", RelPath: "a.txt", Size: 1, FileHash: hash("a")},
+		{Name: "b.txt", Path: "/srv/share/sub/b.txt", Share: "docs", RelPath: "sub/b.txt", Size: 2, FileHash: hash("b")},
+		{Name: "c.txt", Path: "/srv/share/sub/deep/c.txt", Share: "docs", RelPath: "sub/deep/c.txt", Size: 4, FileHash: hash("c")},
+	})
+
+	dirs := idx.Search("sub")
+	if len(dirs) != 1 || !dirs[0].IsDir || dirs[0].Size != 6 {
+		t.Fatalf("Expected the sub directory with 6 bytes, got %+v", dirs)
+	}
+	_, coll, ok := idx.LookupCollection(dirs[0].FileHash)
+	if !ok {
+		t.Fatal("Collection of sub not found")
+	}
+	if coll.Name != "sub" || len(coll.Entries) != 2 || coll.Entries[0].Path != "b.txt" || coll.Entries[1].Path != "deep/c.txt" {
+		t.Errorf("Unexpected collection: %+v", coll)
+	}
+
+	decoded, err := DecodeCollection(dirs[0].FileHash, coll.Encode())
+	if err != nil || len(decoded.Entries) != 2 {
+		t.Fatalf("Round trip failed: %+v, %v", decoded, err)
+	}
+	if _, err := DecodeCollection(dirs[0].FileHash, []byte(`{"Name":"sub"}`)); err == nil {
+		t.Error("Expected a manifest not matching its hash to be rejected")
+	}
+}
+
+func TestDecodeCollectionRejectsEscapingPaths(t *testing.T) {
+	for _, p := range []string{"../evil", "/etc/passwd", "a/../../b", ""} {
+		c := Collection{Name: "dir", Entries: []CollectionEntry{{Path: p, FileHash: encodeHash(hashCodes[HashSHA256], make([]byte, 32))}}}
+		hash, err := c.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeCollection(hash, c.Encode()); err == nil {
+			t.Errorf("Expected path %q to be rejected", p)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package file
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/minio/sha256-simd"
+	mh "github.com/multiformats/go-multihash"
+	"lukechampine.com/blake3"
+)
+
+// Hashes are stored and exchanged as hex-encoded multihashes, so each one
+// names the algorithm that produced it, except SHA-256 hashes: those are
+// bare 64-character hex, as before multihashes were used, so older nodes
+// can still verify them. Multihash-encoded SHA-256 is accepted as well.
+const (
+	HashSHA256 = "sha2-256"
+	HashBLAKE3 = "blake3"
+)
+
+// DefaultHash is the algorithm used when none is configured.
+const DefaultHash = HashSHA256
+
+var hashCodes = map[string]uint64{
+	HashSHA256: mh.SHA2_256,
+	HashBLAKE3: mh.BLAKE3,
+}
+
+// ValidHash reports whether algo can be used to index files.
+func ValidHash(algo string) bool {
+	_, ok := hashCodes[algo]
+	return ok
+}
+
+func hashCode(algo string) (uint64, error) {
+	if algo == "" {
+		algo = DefaultHash
+	}
+	code, ok := hashCodes[algo]
+	if !ok {
+		return 0, fmt.Errorf("unsupported hash algorithm %q", algo)
+	}
+	return code, nil
+}
+
+// newHash returns a hasher for a multihash code.
+func newHash(code uint64) (hash.Hash, error) {
+	switch code {
+	case mh.SHA2_256:
+		return sha256.New(), nil
+	case mh.BLAKE3:
+		return blake3.New(32, nil), nil
+	}
+	return nil, fmt.Errorf("unsupported hash algorithm %s", mh.Codes[code])
+}
+
+func encodeHash(code uint64, digest []byte) string {
+	if code == mh.SHA2_256 {
+		return hex.EncodeToString(digest)
+	}
+	encoded, err := mh.Encode(digest, code)
+	if err != nil {
+		// Only reachable with a code that is not registered with multihash.
+		panic(err)
+	}
+	return hex.EncodeToString(encoded)
+}
+
+// NormalizeHash returns the form a hash is stored and sent in, turning a
+// SHA-256 multihash into bare hex.
+func NormalizeHash(s string) string {
+	if len(s) == 2*(sha256.Size+2) && strings.HasPrefix(s, sha256Prefix) {
+		if _, err := hex.DecodeString(s); err == nil {
+			return s[len(sha256Prefix):]
+		}
+	}
+	return s
+}
+
+// sha256Prefix starts the hex multihash of a SHA-256 digest.
+const sha256Prefix = "1220"
+
+// DecodeHash splits a hex hash into its multihash code and digest.
+func DecodeHash(s string) (code uint64, digest []byte, err error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid hash %q: %w", s, err)
+	}
+	if len(b) == sha256.Size {
+		return mh.SHA2_256, b, nil
+	}
+	decoded, err := mh.Decode(b)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid hash %q: %w", s, err)
+	}
+	return decoded.Code, decoded.Digest, nil
+}
+
+// HashAlgorithm returns the name of the algorithm that produced s.
+func HashAlgorithm(s string) string {
+	code, _, err := DecodeHash(s)
+	if err != nil {
+		return ""
+	}
+	return mh.Codes[code]
+}
+
+// VerifyHash checks data against an encoded hash using whichever algorithm
+// the hash names.
+func VerifyHash(s string, data []byte) error {
+	v, err := NewVerifier(s)
+	if err != nil {
+		return err
+	}
+	v.Write(data)
+	return v.Verify()
+}
+
+// Verifier checks data written to it in pieces against an encoded hash.
+type Verifier struct {
+	h    hash.Hash
+	want []byte
+}
+
+func NewVerifier(s string) (*Verifier, error) {
+	code, want, err := DecodeHash(s)
+	if err != nil {
+		return nil, err
+	}
+	h, err := newHash(code)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{h: h, want: want}, nil
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	return v.h.Write(p)
+}
+
+// Verify reports whether the data written so far matches the hash.
+func (v *Verifier) Verify() error {
+	if !bytes.Equal(v.h.Sum(nil), v.want) {
+		return errors.New("hash mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package file
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSHA256HashesAreBareHex(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello"))
+	legacy := hex.EncodeToString(sum[:])
+	multihash := "1220" + legacy
+
+	if got := encodeHash(hashCodes[HashSHA256], sum[:]); got != legacy {
+		t.Errorf("Expected SHA-256 hashes to be written as bare hex for older nodes, got %s", got)
+	}
+	if got := HashAlgorithm(legacy); got != HashSHA256 {
+		t.Errorf("Expected %s, got %q", HashSHA256, got)
+	}
+	if NormalizeHash(multihash) != legacy || NormalizeHash(legacy) != legacy {
+		t.Error("A SHA-256 multihash was not normalized to bare hex")
+	}
+	for _, h := range []string{legacy, multihash} {
+		if err := VerifyHash(h, []byte("hello")); err != nil {
+			t.Errorf("%s did not verify: %v", h, err)
+		}
+	}
+}
+
+func TestHashFileBLAKE3(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	data := []byte("some file contents")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := NewHasher(1, 0).HashFile(path, info, ChunkingFixed, 0, HashBLAKE3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := HashAlgorithm(meta.FileHash); got != HashBLAKE3 {
+		t.Errorf("Expected a %s file hash, got %q", HashBLAKE3, got)
+	}
+	if got := HashAlgorithm(meta.MerkleRoot); got != HashBLAKE3 {
+		t.Errorf("Expected a %s merkle root, got %q", HashBLAKE3, got)
+	}
+	if err := VerifyHash(meta.Chunks[0].Hash, data); err != nil {
+		t.Errorf("Chunk did not verify: %v", err)
+	}
+	if err := VerifyHash(meta.Chunks[0].Hash, []byte("other contents")); err == nil {
+		t.Error("Expected other data to fail verification")
+	}
+
+	if _, err := NewHasher(1, 0).HashFile(path, info, ChunkingFixed, 0, "md5"); err == nil {
+		t.Error("Expected an unsupported algorithm to be rejected")
+	}
+}
@@ -0,0 +1,277 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// parallelMinChunks is the size, in chunks, from which a single file is
+// split across several workers instead of being read by one.
+const parallelMinChunks = 8
+
+// Hasher hashes files for the index. At most workers chunks are read and
+// hashed at the same time, whether they belong to many small files or to
+// one large one, and reads can be throttled so indexing leaves disk
+// bandwidth for transfers.
+type Hasher struct {
+	workers int
+	slots   chan struct{}
+	limiter *rate.Limiter
+	buffers sync.Pool
+}
+
+// NewHasher returns a Hasher using up to workers goroutines, or one per CPU
+// if workers is 0. readLimit caps reads in bytes per second; 0 means no
+// limit.
+func NewHasher(workers int, readLimit int64) *Hasher {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	h := &Hasher{
+		workers: workers,
+		slots:   make(chan struct{}, workers),
+	}
+	if readLimit > 0 {
+		burst := max(int(readLimit), MaxChunkSize)
+		h.limiter = rate.NewLimiter(rate.Limit(readLimit), burst)
+	}
+	h.buffers.New = func() any {
+		return new([]byte)
+	}
+	return h
+}
+
+type hashJob struct {
+	path      string
+	info      os.FileInfo
+	chunking  string
+	chunkSize int64
+	algo      string
+	meta      FileMeta
+}
+
+// hashAll hashes every job, several files at a time, and fills in their
+// meta. It stops at the first error.
+func (h *Hasher) hashAll(jobs []*hashJob) error {
+	queue := make(chan *hashJob)
+	errs := make(chan error, h.workers)
+	var wg sync.WaitGroup
+	var once sync.Once
+	stop := make(chan struct{})
+
+	for i := 0; i < min(h.workers, len(jobs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				meta, err := h.HashFile(job.path, job.info, job.chunking, job.chunkSize, job.algo)
+				if err != nil {
+					errs <- err
+					once.Do(func() { close(stop) })
+					return
+				}
+				job.meta = meta
+			}
+		}()
+	}
+
+dispatch:
+	for _, job := range jobs {
+		select {
+		case queue <- job:
+		case <-stop:
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+type chunkResult struct {
+	buf  *[]byte
+	n    int
+	hash string
+	err  error
+}
+
+// HashFile computes the file hash and chunk records of path, splitting it
+// as chunking says into chunks of chunkSize bytes, or of that average size
+// for content-defined chunking. A chunkSize of 0 picks one from the size.
+// Hashes are made with algo, or DefaultHash if it is empty.
+func (h *Hasher) HashFile(path string, info os.FileInfo, chunking string, chunkSize int64, algo string) (FileMeta, error) {
+	code, err := hashCode(algo)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return FileMeta{}, err
+	}
+	defer f.Close()
+
+	if chunkSize <= 0 {
+		chunkSize = ChunkSizeFor(info.Size())
+	}
+	var fileHash []byte
+	var chunks []ChunkRecord
+	if chunking == ChunkingCDC {
+		fileHash, chunks, err = h.hashCDC(f, code, chunkSize)
+	} else {
+		chunking = ChunkingFixed
+		fileHash, chunks, err = h.hashFixed(f, code, info.Size(), chunkSize)
+	}
+	if err != nil {
+		return FileMeta{}, err
+	}
+
+	meta := FileMeta{
+		Name:      info.Name(),
+		Path:      path,
+		Size:      info.Size(),
+		FileHash:  encodeHash(code, fileHash),
+		Chunking:  chunking,
+		ChunkSize: chunkSize,
+		Chunks:    chunks,
+	}
+	if err := meta.setMerkleRoot(); err != nil {
+		return FileMeta{}, err
+	}
+	return meta, nil
+}
+
+// hashFixed hashes fixed-size chunks. Large files are read and hashed in
+// parallel chunks; the chunks are fed to the whole-file hash in order as
+// they complete.
+func (h *Hasher) hashFixed(f *os.File, code uint64, size, chunkSize int64) ([]byte, []ChunkRecord, error) {
+	numChunks := int((size + chunkSize - 1) / chunkSize)
+	workers := 1
+	if numChunks >= parallelMinChunks {
+		workers = min(h.workers, numChunks)
+	}
+
+	// results[i] receives chunk i. window bounds how many chunks are held in
+	// memory while the sequencer waits for an earlier one.
+	results := make([]chan chunkResult, numChunks)
+	for i := range results {
+		results[i] = make(chan chunkResult, 1)
+	}
+	window := make(chan struct{}, 2*workers)
+	indexes := make(chan int)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		defer close(indexes)
+		for i := 0; i < numChunks; i++ {
+			select {
+			case window <- struct{}{}:
+			case <-done:
+				return
+			}
+			select {
+			case indexes <- i:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range indexes {
+				results[i] <- h.hashChunk(f, code, int64(i)*chunkSize, chunkSize)
+			}
+		}()
+	}
+
+	fileHash, _ := newHash(code)
+	chunks := make([]ChunkRecord, 0, numChunks)
+	for i := 0; i < numChunks; i++ {
+		res := <-results[i]
+		if res.err != nil {
+			return nil, nil, res.err
+		}
+		fileHash.Write((*res.buf)[:res.n])
+		h.buffers.Put(res.buf)
+		<-window
+		chunks = append(chunks, ChunkRecord{Offset: int64(i) * chunkSize, Length: int64(res.n), Hash: res.hash})
+	}
+	return fileHash.Sum(nil), chunks, nil
+}
+
+// hashCDC hashes content-defined chunks. Finding a boundary depends on the
+// bytes before it, so the file is read by one worker from start to end.
+func (h *Hasher) hashCDC(f *os.File, code uint64, avgSize int64) ([]byte, []ChunkRecord, error) {
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	fileHash, _ := newHash(code)
+	chunkHash, _ := newHash(code)
+	var chunks []ChunkRecord
+	var offset int64
+	err := newCDCParams(avgSize).split(h.throttle(f), func(chunk []byte) error {
+		chunkHash.Reset()
+		chunkHash.Write(chunk)
+		fileHash.Write(chunk)
+		chunks = append(chunks, ChunkRecord{Offset: offset, Length: int64(len(chunk)), Hash: encodeHash(code, chunkHash.Sum(nil))})
+		offset += int64(len(chunk))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return fileHash.Sum(nil), chunks, nil
+}
+
+// throttle wraps r so its reads respect the read limit.
+func (h *Hasher) throttle(r io.Reader) io.Reader {
+	if h.limiter == nil {
+		return r
+	}
+	return &throttledReader{r: r, limiter: h.limiter}
+}
+
+type throttledReader struct {
+	r       io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.Burst() {
+		p = p[:t.limiter.Burst()]
+	}
+	if err := t.limiter.WaitN(context.Background(), len(p)); err != nil {
+		return 0, err
+	}
+	return t.r.Read(p)
+}
+
+func (h *Hasher) hashChunk(f *os.File, code uint64, offset, length int64) chunkResult {
+	h.slots <- struct{}{}
+	defer func() { <-h.slots }()
+
+	buf := h.buffers.Get().(*[]byte)
+	if int64(cap(*buf)) < length {
+		*buf = make([]byte, length)
+	}
+	*buf = (*buf)[:length]
+	if h.limiter != nil {
+		if err := h.limiter.WaitN(context.Background(), int(length)); err != nil {
+			return chunkResult{buf: buf, err: err}
+		}
+	}
+	n, err := f.ReadAt(*buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return chunkResult{buf: buf, err: err}
+	}
+	sum, _ := newHash(code)
+	sum.Write((*buf)[:n])
+	return chunkResult{buf: buf, n: n, hash: encodeHash(code, sum.Sum(nil))}
+}
@@ -0,0 +1,88 @@
+package file
+
+import (
+	"crypto/sha256"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHasherParallelMatchesSequential(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 10*ChunkSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(dir, "big.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta, err := NewHasher(4, 0).HashFile(path, info, ChunkingFixed, ChunkSize, HashSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if meta.FileHash != encodeHash(hashCodes[HashSHA256], sum[:]) {
+		t.Error("Parallel file hash does not match the hash of the whole file")
+	}
+	if len(meta.Chunks) != 11 {
+		t.Fatalf("Expected 11 chunks, got %d", len(meta.Chunks))
+	}
+	for i, c := range meta.Chunks {
+		end := min((i+1)*ChunkSize, len(data))
+		want := sha256.Sum256(data[i*ChunkSize : end])
+		if c.Hash != encodeHash(hashCodes[HashSHA256], want[:]) || c.Offset != int64(i*ChunkSize) || c.Length != int64(end-i*ChunkSize) {
+			t.Errorf("Chunk %d record mismatch: %+v", i, c)
+		}
+	}
+}
+
+func TestHasherHashAll(t *testing.T) {
+	dir := t.TempDir()
+	var jobs []*hashJob
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, string(rune('a'+i))+".txt")
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, _ := os.Stat(path)
+		jobs = append(jobs, &hashJob{path: path, info: info})
+	}
+
+	if err := NewHasher(3, 64<<20).hashAll(jobs); err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range jobs {
+		sum := sha256.Sum256([]byte(job.path))
+		if job.meta.FileHash != encodeHash(hashCodes[HashSHA256], sum[:]) {
+			t.Errorf("Wrong hash for %s", job.path)
+		}
+	}
+
+	os.Remove(jobs[5].path)
+	if err := NewHasher(3, 0).hashAll(jobs); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestChunkSizeFor(t *testing.T) {
+	cases := []struct {
+		size int64
+		want int64
+	}{
+		{0, 256 << 10},
+		{10 << 20, 256 << 10},
+		{500 << 20, 1 << 20},
+		{8 << 30, 4 << 20},
+		{100 << 30, 16 << 20},
+	}
+	for _, c := range cases {
+		if got := ChunkSizeFor(c.size); got != c.want {
+			t.Errorf("ChunkSizeFor(%d) = %d, want %d", c.size, got, c.want)
+		}
+	}
+}
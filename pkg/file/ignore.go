@@ -0,0 +1,209 @@
+package file
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the per-directory ignore file. It uses gitignore syntax
+// and its rules apply to the directory it is in and everything below it.
+const IgnoreFileName = ".peerfsignore"
+
+type ignoreRule struct {
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Ignore is an ordered list of gitignore-style rules. As in git, the last
+// matching rule wins, so rules from deeper directories override those of
+// their parents.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+// NewIgnore returns rules that apply from the share root downwards.
+func NewIgnore(patterns []string) *Ignore {
+	ig := &Ignore{}
+	ig.Add("", patterns)
+	return ig
+}
+
+// Add appends patterns scoped to base, a slash-separated directory relative
+// to the share root ("" for the root itself).
+func (ig *Ignore) Add(base string, patterns []string) {
+	for _, p := range patterns {
+		if rule, ok := compileIgnoreRule(base, p); ok {
+			ig.rules = append(ig.rules, rule)
+		}
+	}
+}
+
+// LoadFile adds the rules of the ignore file in dir, if there is one. base
+// is dir relative to the share root.
+func (ig *Ignore) LoadFile(dir, base string) error {
+	f, err := os.Open(filepath.Join(dir, IgnoreFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if base == "." {
+		base = ""
+	}
+	ig.Add(base, lines)
+	return nil
+}
+
+// Match reports whether rel itself is ignored, without looking at its
+// parent directories. Directory walks use it since ignored directories are
+// never entered.
+func (ig *Ignore) Match(rel string, isDir bool) bool {
+	ignored := false
+	for _, r := range ig.rules {
+		sub := rel
+		if r.base != "" {
+			if !strings.HasPrefix(rel, r.base+"/") {
+				continue
+			}
+			sub = rel[len(r.base)+1:]
+		}
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.re.MatchString(sub) {
+			ignored = !r.negate
+		}
+	}
+	return ignored
+}
+
+// Ignored reports whether rel or any directory above it is ignored.
+func (ig *Ignore) Ignored(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := 1; i < len(parts); i++ {
+		if ig.Match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return ig.Match(rel, isDir)
+}
+
+func compileIgnoreRule(base, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	// A pattern containing a slash is relative to base; one without only
+	// looks at the name and matches at any depth.
+	anchored := strings.Contains(line, "/")
+	expr := globToRegexp(strings.TrimPrefix(line, "/"))
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				if i+2 < len(glob) && glob[i+2] == '/' {
+					// "**/" matches zero or more directories.
+					b.WriteString("(?:.*/)?")
+					i += 2
+				} else {
+					b.WriteString(".*")
+					i++
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// loadIgnoreChain builds the rules that apply to rel by reading the ignore
+// files of the share root and every directory down to rel's parent.
+func (s Share) loadIgnoreChain(rel string) (*Ignore, error) {
+	ig := s.baseIgnore()
+	if err := ig.LoadFile(s.Root, ""); err != nil {
+		return nil, err
+	}
+	dir := path.Dir(rel)
+	if dir == "." {
+		return ig, nil
+	}
+	parts := strings.Split(dir, "/")
+	for i := 1; i <= len(parts); i++ {
+		base := strings.Join(parts[:i], "/")
+		if err := ig.LoadFile(filepath.Join(s.Root, filepath.FromSlash(base)), base); err != nil {
+			return nil, err
+		}
+	}
+	return ig, nil
+}
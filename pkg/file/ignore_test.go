@@ -0,0 +1,92 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	ig := NewIgnore([]string{"*.tmp", "build/", "/top.txt", "docs/**/draft-*", "!keep.tmp"})
+	ig.Add("sub", []string{"*.csv", "!important.csv"})
+
+	cases := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"a.tmp", false, true},
+		{"deep/dir/a.tmp", false, true},
+		{"keep.tmp", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"top.txt", false, true},
+		{"nested/top.txt", false, false},
+		{"docs/draft-1.md", false, true},
+		{"docs/a/b/draft-2.md", false, true},
+		{"docs/final.md", false, false},
+		{"sub/data.csv", false, true},
+		{"sub/important.csv", false, false},
+		{"data.csv", false, false},
+	}
+	for _, c := range cases {
+		if got := ig.Match(c.rel, c.isDir); got != c.want {
+			t.Errorf("Match(%q, %t) = %t, want %t", c.rel, c.isDir, got, c.want)
+		}
+	}
+	if !ig.Ignored("build/out.bin", false) {
+		t.Error("Expected files below an ignored directory to be ignored")
+	}
+}
+
+func TestShareWalkHonoursIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".peerfsignore":          "*.log\nsecret/\n",
+		"a.txt":                  "a",
+		"run.log":                "log",
+		".git/HEAD":              "ref",
+		"secret/key.pem":         "key",
+		"docs/.peerfsignore":     "!keep.log\ndraft.md\n",
+		"docs/keep.log":          "kept",
+		"docs/other.log":         "skipped",
+		"docs/draft.md":          "draft",
+		"docs/readme.md":         "readme",
+		"photos/.peerfsignore":   "# nothing ignored here\n",
+		"photos/holiday.jpg.swp": "swap",
+		"photos/holiday.jpg":     "jpg",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	share := Share{Name: "s", Root: root, Ignore: []string{".git/", "*.swp"}}
+	var got []string
+	err := share.Walk(func(path, rel string, info os.FileInfo) error {
+		got = append(got, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "docs/keep.log", "docs/readme.md", "photos/holiday.jpg"}
+	slices.Sort(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("Walk visited %v, want %v", got, want)
+	}
+
+	// Single paths, as the watcher reports them, must follow the same rules.
+	for _, rel := range []string{"docs/other.log", "secret/key.pem", ".git/HEAD", "docs/.peerfsignore"} {
+		if skipped, err := share.Skipped(rel); err != nil || !skipped {
+			t.Errorf("Expected %s to be skipped (err %v)", rel, err)
+		}
+	}
+	if skipped, _ := share.Skipped("docs/keep.log"); skipped {
+		t.Error("Expected docs/keep.log to be re-included by its directory's ignore file")
+	}
+}
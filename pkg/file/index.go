@@ -0,0 +1,305 @@
+package file
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Index is a concurrency-safe set of indexed files shared by the transfer,
+// search and download code paths of a node. Updates never modify a slice
+// previously returned by Files, so readers always see a consistent snapshot.
+type Index struct {
+	mu    sync.RWMutex
+	files []FileMeta
+	// shared is set once files has been handed out, by Files or to a
+	// collection set, so the next update copies it before changing it.
+	shared atomic.Bool
+	// byHash and byRoot list every file with a given hash, as the same
+	// content can be indexed in several places.
+	byHash map[string][]int
+	byRoot map[string][]int
+	byPath map[string]int
+	// byChunk locates every chunk hash in each file holding it.
+	byChunk map[string][]chunkLocation
+	// collections holds the directory manifests of files, built on first
+	// use. collectionsMu guards creating it under a read lock of mu.
+	collectionsMu sync.Mutex
+	collections   *collectionSet
+}
+
+type chunkLocation struct {
+	file, chunk int
+}
+
+func NewIndex(files []FileMeta) *Index {
+	idx := &Index{}
+	idx.Replace(files)
+	return idx
+}
+
+// Replace swaps the whole index contents in one step.
+func (idx *Index) Replace(files []FileMeta) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.swap(files)
+	// files still belongs to the caller.
+	idx.shared.Store(true)
+}
+
+// Upsert adds meta, replacing any entry for the same path. It reports
+// whether an entry was replaced.
+func (idx *Index) Upsert(meta FileMeta) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.own()
+	if i, ok := idx.byPath[meta.Path]; ok {
+		idx.unindex(i)
+		idx.files[i] = meta
+		idx.index(i)
+		return true
+	}
+	idx.files = append(idx.files, meta)
+	idx.index(len(idx.files) - 1)
+	return false
+}
+
+// RemovePath drops the file of share at path, or every file of share below
+// it if path is a directory, and returns the removed entries.
+func (idx *Index) RemovePath(share, path string) []FileMeta {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var remove []int
+	if i, ok := idx.byPath[path]; ok {
+		if idx.files[i].Share == share {
+			remove = append(remove, i)
+		}
+	} else {
+		prefix := filepath.Clean(path) + string(filepath.Separator)
+		for i, f := range idx.files {
+			if f.Share == share && strings.HasPrefix(f.Path, prefix) {
+				remove = append(remove, i)
+			}
+		}
+	}
+	if len(remove) == 0 {
+		return nil
+	}
+
+	removed := make([]FileMeta, len(remove))
+	for i, j := range remove {
+		removed[i] = idx.files[j]
+	}
+	idx.own()
+	// Going backwards, the last file, moved into each freed slot, is never
+	// one still to be removed.
+	for _, i := range slices.Backward(remove) {
+		idx.removeAt(i)
+	}
+	return removed
+}
+
+// ReplaceShare swaps the entries of one share, leaving other shares alone.
+func (idx *Index) ReplaceShare(name string, shareFiles []FileMeta) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	files := make([]FileMeta, 0, len(idx.files)+len(shareFiles))
+	for _, f := range idx.files {
+		if f.Share != name {
+			files = append(files, f)
+		}
+	}
+	idx.swap(append(files, shareFiles...))
+}
+
+func (idx *Index) RemoveShare(name string) {
+	idx.ReplaceShare(name, nil)
+}
+
+func (idx *Index) swap(files []FileMeta) {
+	idx.files = files
+	idx.shared.Store(false)
+	idx.collections = nil
+	idx.byHash = make(map[string][]int, len(files))
+	idx.byRoot = make(map[string][]int, len(files))
+	idx.byPath = make(map[string]int, len(files))
+	idx.byChunk = make(map[string][]chunkLocation)
+	for i := range files {
+		idx.index(i)
+	}
+}
+
+// own prepares files for an update in place, copying it if readers may
+// hold it. Callers hold mu.
+func (idx *Index) own() {
+	if idx.shared.Load() {
+		idx.files = slices.Clone(idx.files)
+		idx.shared.Store(false)
+	}
+	idx.collections = nil
+}
+
+// index adds files[i] to the lookup maps.
+func (idx *Index) index(i int) {
+	f := idx.files[i]
+	idx.byHash[f.FileHash] = append(idx.byHash[f.FileHash], i)
+	if f.MerkleRoot != "" {
+		idx.byRoot[f.MerkleRoot] = append(idx.byRoot[f.MerkleRoot], i)
+	}
+	idx.byPath[f.Path] = i
+	for j, c := range f.Chunks {
+		idx.byChunk[c.Hash] = append(idx.byChunk[c.Hash], chunkLocation{file: i, chunk: j})
+	}
+}
+
+// unindex removes files[i] from the lookup maps.
+func (idx *Index) unindex(i int) {
+	f := idx.files[i]
+	removeIndex(idx.byHash, f.FileHash, i)
+	removeIndex(idx.byRoot, f.MerkleRoot, i)
+	if idx.byPath[f.Path] == i {
+		delete(idx.byPath, f.Path)
+	}
+	for _, c := range f.Chunks {
+		locs := slices.DeleteFunc(idx.byChunk[c.Hash], func(loc chunkLocation) bool { return loc.file == i })
+		if len(locs) == 0 {
+			delete(idx.byChunk, c.Hash)
+		} else {
+			idx.byChunk[c.Hash] = locs
+		}
+	}
+}
+
+// removeAt drops files[i], moving the last file into its place.
+func (idx *Index) removeAt(i int) {
+	last := len(idx.files) - 1
+	idx.unindex(i)
+	if i != last {
+		idx.unindex(last)
+		idx.files[i] = idx.files[last]
+		idx.index(i)
+	}
+	idx.files[last] = FileMeta{}
+	idx.files = idx.files[:last]
+}
+
+func removeIndex(m map[string][]int, key string, i int) {
+	list := slices.DeleteFunc(m[key], func(j int) bool { return j == i })
+	if len(list) == 0 {
+		delete(m, key)
+	} else {
+		m[key] = list
+	}
+}
+
+// Files returns the current contents. Callers must not modify the slice.
+func (idx *Index) Files() []FileMeta {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	idx.shared.Store(true)
+	return idx.files
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.files)
+}
+
+// Lookup finds a file by its hash or by its Merkle root.
+func (idx *Index) Lookup(hash string) (FileMeta, bool) {
+	return idx.LookupFunc(hash, nil)
+}
+
+// LookupFunc is like Lookup, but only returns a file for which keep, if
+// not nil, returns true.
+func (idx *Index) LookupFunc(hash string, keep func(FileMeta) bool) (FileMeta, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	hash = NormalizeHash(hash)
+	for _, list := range [][]int{idx.byHash[hash], idx.byRoot[hash]} {
+		for _, i := range list {
+			if keep == nil || keep(idx.files[i]) {
+				return idx.files[i], true
+			}
+		}
+	}
+	return FileMeta{}, false
+}
+
+func (idx *Index) LookupPath(path string) (FileMeta, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	i, ok := idx.byPath[path]
+	if !ok {
+		return FileMeta{}, false
+	}
+	return idx.files[i], true
+}
+
+// LookupChunk finds a file holding the chunk with the given hash, and
+// where in that file it is.
+func (idx *Index) LookupChunk(hash string) (FileMeta, ChunkRecord, bool) {
+	return idx.LookupChunkFunc(hash, nil)
+}
+
+// LookupChunkFunc is like LookupChunk, but only considers files for which
+// keep, if not nil, returns true.
+func (idx *Index) LookupChunkFunc(hash string, keep func(FileMeta) bool) (FileMeta, ChunkRecord, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for _, loc := range idx.byChunk[NormalizeHash(hash)] {
+		meta := idx.files[loc.file]
+		if keep == nil || keep(meta) {
+			return meta, meta.Chunks[loc.chunk], true
+		}
+	}
+	return FileMeta{}, ChunkRecord{}, false
+}
+
+// LookupCollection returns the directory whose collection has the given
+// hash, and the collection itself.
+func (idx *Index) LookupCollection(hash string) (FileMeta, Collection, bool) {
+	return idx.LookupCollectionFunc(hash, nil)
+}
+
+// LookupCollectionFunc is like LookupCollection, but only returns a
+// directory for which keep, if not nil, returns true.
+func (idx *Index) LookupCollectionFunc(hash string, keep func(FileMeta) bool) (FileMeta, Collection, bool) {
+	cs := idx.collectionSet()
+	for _, i := range cs.byHash[NormalizeHash(hash)] {
+		if keep == nil || keep(cs.dirs[i]) {
+			return cs.dirs[i], cs.colls[i], true
+		}
+	}
+	return FileMeta{}, Collection{}, false
+}
+
+// Dirs returns every directory that has a collection. Callers must not
+// modify the slice.
+func (idx *Index) Dirs() []FileMeta {
+	return idx.collectionSet().dirs
+}
+
+// Search returns the files and directories whose name contains query.
+func (idx *Index) Search(query string) []FileMeta {
+	return append(SearchLocal(idx.Files(), query), SearchLocal(idx.collectionSet().dirs, query)...)
+}
+
+func (idx *Index) collectionSet() *collectionSet {
+	idx.mu.RLock()
+	idx.collectionsMu.Lock()
+	if idx.collections == nil {
+		idx.collections = &collectionSet{files: idx.files}
+		idx.shared.Store(true)
+	}
+	cs := idx.collections
+	idx.collectionsMu.Unlock()
+	idx.mu.RUnlock()
+	return cs.get()
+}
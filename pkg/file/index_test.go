@@ -0,0 +1,95 @@
+package file
+
+import "testing"
+
+func TestIndexLookupAndReplace(t *testing.T) {
+	idx := NewIndex([]FileMeta{
+		{Name: "Movie.mp4", FileHash: "aa"},
+		{Name: "Sample1.txt", FileHash: "bb"},
+	})
+
+	meta, ok := idx.Lookup("bb")
+	if !ok || meta.Name != "Sample1.txt" {
+		t.Errorf("Expected Sample1.txt for hash bb, got %+v", meta)
+	}
+	if results := idx.Search("movie"); len(results) != 1 {
+		t.Errorf("Expected 1 search result, got %d", len(results))
+	}
+
+	idx.Replace([]FileMeta{{Name: "Other.bin", FileHash: "cc"}})
+	if _, ok := idx.Lookup("bb"); ok {
+		t.Error("Expected hash bb to be gone after Replace")
+	}
+	if idx.Len() != 1 {
+		t.Errorf("Expected 1 file, got %d", idx.Len())
+	}
+}
+
+func TestIndexKeepsEveryCopy(t *testing.T) {
+	chunks := []ChunkRecord{{Hash: "c1", Length: 1}}
+	idx := NewIndex([]FileMeta{
+		{Name: "private.bin", Path: "/private/a.bin", Share: "private", FileHash: "aa", Chunks: chunks},
+		{Name: "public.bin", Path: "/public/a.bin", Share: "public", FileHash: "aa", Chunks: chunks},
+	})
+	public := func(meta FileMeta) bool { return meta.Share == "public" }
+
+	if meta, ok := idx.LookupFunc("aa", public); !ok || meta.Share != "public" {
+		t.Errorf("Expected the public copy, got %+v", meta)
+	}
+	if meta, _, ok := idx.LookupChunkFunc("c1", public); !ok || meta.Share != "public" {
+		t.Errorf("Expected the chunk of the public copy, got %+v", meta)
+	}
+	if _, ok := idx.LookupFunc("aa", func(FileMeta) bool { return false }); ok {
+		t.Error("Expected no file when every copy is filtered out")
+	}
+
+	removed := idx.RemovePath("private", "/public/a.bin")
+	if len(removed) != 0 {
+		t.Errorf("Expected RemovePath to leave other shares alone, removed %+v", removed)
+	}
+	if removed := idx.RemovePath("public", "/public"); len(removed) != 1 || idx.Len() != 1 {
+		t.Errorf("Expected the public copy to be removed, removed %+v", removed)
+	}
+	if meta, ok := idx.Lookup("aa"); !ok || meta.Share != "private" {
+		t.Errorf("Expected the private copy to remain, got %+v", meta)
+	}
+}
+
+func TestIndexUpdatesInPlace(t *testing.T) {
+	idx := NewIndex(nil)
+	for _, name := range []string{"a", "b", "c"} {
+		idx.Upsert(FileMeta{Name: name, Path: "/s/" + name, Share: "s", FileHash: name + name, Chunks: []ChunkRecord{{Hash: "c" + name}}})
+	}
+	before := idx.Files()
+
+	if !idx.Upsert(FileMeta{Name: "b", Path: "/s/b", Share: "s", FileHash: "b2", Chunks: []ChunkRecord{{Hash: "cb2"}}}) {
+		t.Error("Expected Upsert to replace the entry for /s/b")
+	}
+	if removed := idx.RemovePath("s", "/s/a"); len(removed) != 1 || removed[0].Name != "a" {
+		t.Errorf("Expected a to be removed, removed %+v", removed)
+	}
+
+	if len(before) != 3 || before[0].Name != "a" || before[1].FileHash != "bb" {
+		t.Errorf("Expected an earlier snapshot to stay unchanged, got %+v", before)
+	}
+	if idx.Len() != 2 {
+		t.Errorf("Expected 2 files, got %d", idx.Len())
+	}
+	for _, hash := range []string{"aa", "bb", "ca", "cb"} {
+		if _, ok := idx.Lookup(hash); ok {
+			t.Errorf("Expected %s to be gone", hash)
+		}
+		if _, _, ok := idx.LookupChunk(hash); ok {
+			t.Errorf("Expected chunk %s to be gone", hash)
+		}
+	}
+	if meta, chunk, ok := idx.LookupChunk("cc"); !ok || meta.Name != "c" || chunk.Hash != "cc" {
+		t.Errorf("Expected chunk cc in c after it moved, got %+v", meta)
+	}
+	if meta, ok := idx.LookupPath("/s/c"); !ok || meta.Name != "c" {
+		t.Errorf("Expected /s/c by path, got %+v", meta)
+	}
+	if meta, ok := idx.Lookup("b2"); !ok || meta.Path != "/s/b" {
+		t.Errorf("Expected the new b, got %+v", meta)
+	}
+}
@@ -1,35 +1,66 @@
 package file
 
 import (
-	"encoding/hex"
-	"io"
 	"os"
-	"path/filepath"
-
-	"github.com/minio/sha256-simd"
 )
 
+// ChunkSize is the default chunk size, used where no file size is known.
 const ChunkSize = 1024 * 1024
 
+// Chunk sizes a share may be configured with. They must be powers of two.
+const (
+	MinChunkSize = 64 * 1024
+	MaxChunkSize = 16 * 1024 * 1024
+)
+
+// ChunkSizeFor picks the chunk size for a file of size bytes: small chunks
+// for small files, and large ones for huge files so they do not take tens
+// of thousands of chunk requests.
+func ChunkSizeFor(size int64) int64 {
+	switch {
+	case size <= 64<<20:
+		return 256 << 10
+	case size <= 1<<30:
+		return 1 << 20
+	case size <= 16<<30:
+		return 4 << 20
+	default:
+		return MaxChunkSize
+	}
+}
+
 type FileMeta struct {
-	Name      string
-	Path      string
-	Size      int64
-	FileHash  string
-	ChunkHash []string
+	Name string
+	Path string
+	// Share is the name of the share the file belongs to and RelPath its
+	// slash-separated path inside that share.
+	Share    string `json:",omitempty"`
+	RelPath  string `json:",omitempty"`
+	Size     int64
+	FileHash string
+	// MerkleRoot is the hex root of the Merkle tree over the chunk hashes;
+	// it is all a downloader needs to verify each chunk.
+	MerkleRoot string
+	NumChunks  int
+	// Chunking is how the file was split: ChunkingFixed or ChunkingCDC.
+	// ChunkSize is the size of each fixed chunk, or the average size of
+	// content-defined ones.
+	Chunking  string `json:",omitempty"`
+	ChunkSize int64  `json:",omitempty"`
+	// IsDir marks a directory, as returned by a search. Its FileHash is the
+	// hash of its collection and Size the total size of its files.
+	IsDir bool `json:",omitempty"`
+	// Chunks is only kept in the local index. Peers fetch the records they
+	// need, with a proof against MerkleRoot, over the proof protocol.
+	Chunks []ChunkRecord `json:",omitempty"`
 }
 
 func IndexDirectory(dir string) ([]FileMeta, error) {
 	var files []FileMeta
+	hasher := NewHasher(1, 0)
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() {
-			return nil
-		}
-		meta, err := indexFile(path, info)
+	err := Share{Root: dir}.Walk(func(path, rel string, info os.FileInfo) error {
+		meta, err := hasher.HashFile(path, info, ChunkingFixed, ChunkSizeFor(info.Size()), DefaultHash)
 		if err != nil {
 			return err
 		}
@@ -40,40 +71,46 @@ func IndexDirectory(dir string) ([]FileMeta, error) {
 	return files, err
 }
 
-func indexFile(path string, info os.FileInfo) (FileMeta, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return FileMeta{}, err
-	}
-	defer f.Close()
-
-	totalFileHash := sha256.New()
-	var chunkHashes []string
-
-	buf := make([]byte, chunkSize)
-
-	for {
-		n, err := f.Read(buf)
-		if err != nil && err != io.EOF {
-			return FileMeta{}, err
-		}
-		if n == 0 {
-			break
-		}
+const (
+	// ChunkingFixed splits a file into chunks of its ChunkSize, the last
+	// one possibly shorter.
+	ChunkingFixed = "fixed"
+	// ChunkingCDC splits files at content-defined boundaries, so similar
+	// files share most of their chunks.
+	ChunkingCDC = "cdc"
+)
 
-		chunkData := buf[:n]
+// ChunkRecord is one piece of a file. Chunks are transferred and verified
+// by their hash, so a chunk found in several files is only fetched once.
+type ChunkRecord struct {
+	Offset int64
+	Length int64
+	Hash   string
+}
 
-		chunkHash := sha256.Sum256(chunkData)
-		chunkHashes = append(chunkHashes, hex.EncodeToString(chunkHash[:]))
+// Summary returns meta without its chunk records, the form sent to peers.
+func (m FileMeta) Summary() FileMeta {
+	m.Chunks = nil
+	return m
+}
 
-		totalFileHash.Write(chunkData)
+// ChunkHashes returns the hash of every chunk in order, the leaves of the
+// file's Merkle tree.
+func (m FileMeta) ChunkHashes() []string {
+	hashes := make([]string, len(m.Chunks))
+	for i, c := range m.Chunks {
+		hashes[i] = c.Hash
 	}
+	return hashes
+}
 
-	return FileMeta{
-		Name:      info.Name(),
-		Path:      path,
-		Size:      info.Size(),
-		FileHash:  hex.EncodeToString(totalFileHash.Sum(nil)),
-		ChunkHash: chunkHashes,
-	}, nil
+// setMerkleRoot derives MerkleRoot and NumChunks from the chunk records.
+func (m *FileMeta) setMerkleRoot() error {
+	tree, err := MerkleTreeFromHex(m.ChunkHashes())
+	if err != nil {
+		return err
+	}
+	m.MerkleRoot = tree.RootHash()
+	m.NumChunks = len(m.Chunks)
+	return nil
 }
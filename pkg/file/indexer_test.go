@@ -14,7 +14,7 @@ func TestIndexDirectory(t *testing.T) {
 	if first.FileHash == "" {
 		t.Error("Expected File Hash, Got Empty")
 	}
-	if len(first.ChunkHash) == 0 {
+	if len(first.Chunks) == 0 {
 		t.Error("Expected Chunk Hashes, Got None")
 	}
 }
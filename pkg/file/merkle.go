@@ -0,0 +1,151 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// The Merkle tree of a file has its chunk digests as leaves. Each parent is
+// the hash, with the chunks' algorithm, of a 0x01 byte followed by its two
+// children; a node without a sibling is promoted to the next level
+// unchanged. The node at level k and position j therefore covers chunks
+// [j<<k, (j+1)<<k), which lets a provider send any aligned run of chunk
+// hashes with the few sibling hashes needed to tie it to the root.
+
+const merkleNodePrefix = 0x01
+
+// MerkleTree holds every level of a file's tree, leaves first.
+type MerkleTree struct {
+	code   uint64
+	levels [][][]byte
+}
+
+// NewMerkleTree builds a tree over leaf digests made with the multihash
+// algorithm code.
+func NewMerkleTree(code uint64, leaves [][]byte) (*MerkleTree, error) {
+	if _, err := newHash(code); err != nil {
+		return nil, err
+	}
+	t := &MerkleTree{code: code, levels: [][][]byte{leaves}}
+	for level := leaves; len(level) > 1; {
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			next = append(next, merkleParent(code, level[i], level[i+1]))
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t, nil
+}
+
+// MerkleTreeFromHex builds the tree of a file from its encoded chunk
+// hashes, which must all use the same algorithm.
+func MerkleTreeFromHex(chunkHashes []string) (*MerkleTree, error) {
+	code := hashCodes[DefaultHash]
+	leaves := make([][]byte, len(chunkHashes))
+	for i, h := range chunkHashes {
+		c, digest, err := DecodeHash(h)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if i > 0 && c != code {
+			return nil, fmt.Errorf("chunk %d uses a different hash algorithm", i)
+		}
+		code, leaves[i] = c, digest
+	}
+	return NewMerkleTree(code, leaves)
+}
+
+// Root returns the root digest, or nil for a file without chunks.
+func (t *MerkleTree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		return nil
+	}
+	return top[0]
+}
+
+// RootHash returns the encoded root hash, or "" for a file without chunks.
+func (t *MerkleTree) RootHash() string {
+	root := t.Root()
+	if root == nil {
+		return ""
+	}
+	return encodeHash(t.code, root)
+}
+
+// Subtree returns the chunk hashes below node (level, index) and the
+// sibling hashes from that node up to the root.
+func (t *MerkleTree) Subtree(level, index int) (leaves [][]byte, proof [][]byte, err error) {
+	if level < 0 || level >= len(t.levels) || index < 0 || index >= len(t.levels[level]) {
+		return nil, nil, fmt.Errorf("no merkle node at level %d index %d", level, index)
+	}
+	start := index << level
+	end := min((index+1)<<level, len(t.levels[0]))
+	leaves = t.levels[0][start:end]
+
+	for k := level; k < len(t.levels)-1; k++ {
+		sibling := index ^ 1
+		if sibling < len(t.levels[k]) {
+			proof = append(proof, t.levels[k][sibling])
+		}
+		index >>= 1
+	}
+	return leaves, proof, nil
+}
+
+// VerifySubtree checks that leaves are the chunk digests below node (level,
+// index) of a tree with numLeaves leaves and the given encoded root.
+func VerifySubtree(rootHash string, numLeaves, level, index int, leaves, proof [][]byte) error {
+	code, root, err := DecodeHash(rootHash)
+	if err != nil {
+		return err
+	}
+	start := index << level
+	want := min((index+1)<<level, numLeaves) - start
+	if index < 0 || start >= numLeaves || len(leaves) != want {
+		return errors.New("merkle subtree does not match the file's chunk count")
+	}
+
+	tree, err := NewMerkleTree(code, leaves)
+	if err != nil {
+		return err
+	}
+	node := tree.Root()
+	size := (numLeaves + 1<<level - 1) >> level
+	for ; size > 1; size = (size + 1) / 2 {
+		if sibling := index ^ 1; sibling < size {
+			if len(proof) == 0 {
+				return errors.New("merkle proof is too short")
+			}
+			if index%2 == 0 {
+				node = merkleParent(code, node, proof[0])
+			} else {
+				node = merkleParent(code, proof[0], node)
+			}
+			proof = proof[1:]
+		}
+		index >>= 1
+	}
+	if len(proof) != 0 {
+		return errors.New("merkle proof is too long")
+	}
+	if !bytes.Equal(node, root) {
+		return errors.New("merkle proof does not lead to the file's root")
+	}
+	return nil
+}
+
+func merkleParent(code uint64, left, right []byte) []byte {
+	// The code was checked by NewMerkleTree or DecodeHash.
+	h, _ := newHash(code)
+	h.Write([]byte{merkleNodePrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
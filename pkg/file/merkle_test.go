@@ -0,0 +1,44 @@
+package file
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestMerkleSubtreeProofs(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 7, 8, 13} {
+		leaves := make([][]byte, n)
+		for i := range leaves {
+			sum := sha256.Sum256([]byte{byte(i)})
+			leaves[i] = sum[:]
+		}
+		tree, err := NewMerkleTree(hashCodes[HashSHA256], leaves)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root := tree.RootHash()
+
+		for level := 0; (1 << level) < 2*n; level++ {
+			for index := 0; index<<level < n; index++ {
+				sub, proof, err := tree.Subtree(level, index)
+				if err != nil {
+					t.Fatalf("n=%d level=%d index=%d: %v", n, level, index, err)
+				}
+				if err := VerifySubtree(root, n, level, index, sub, proof); err != nil {
+					t.Errorf("n=%d level=%d index=%d: %v", n, level, index, err)
+				}
+			}
+		}
+
+		sub, proof, _ := tree.Subtree(0, n-1)
+		bad := sha256.Sum256([]byte("tampered"))
+		if err := VerifySubtree(root, n, 0, n-1, [][]byte{bad[:]}, proof); err == nil {
+			t.Errorf("n=%d: expected a tampered leaf to be rejected", n)
+		}
+		if n > 1 {
+			if err := VerifySubtree(root, n, 0, 0, sub, proof); err == nil {
+				t.Errorf("n=%d: expected a leaf at the wrong position to be rejected", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package file
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Share is a named directory whose files are indexed. Ignore and Exclude
+// hold gitignore-style patterns applied from Root, followed by the
+// .peerfsignore files found in the tree. Include holds glob patterns matched
+// against both the slash-separated path relative to Root and the base name;
+// if it is not empty, a file must match one of them as well.
+type Share struct {
+	Name string
+	Root string
+	// Ignore holds the node-wide patterns, Exclude those of this share.
+	Ignore  []string
+	Include []string
+	Exclude []string
+	// Chunking is ChunkingFixed (the default) or ChunkingCDC.
+	Chunking string
+	// ChunkSize overrides the size picked by ChunkSizeFor when set.
+	ChunkSize int64
+	// Hash is the hash algorithm, DefaultHash if empty.
+	Hash string
+}
+
+func (s Share) chunkSizeFor(size int64) int64 {
+	if s.ChunkSize > 0 {
+		return s.ChunkSize
+	}
+	return ChunkSizeFor(size)
+}
+
+func (s Share) chunking() string {
+	if s.Chunking == ChunkingCDC {
+		return ChunkingCDC
+	}
+	return ChunkingFixed
+}
+
+func (s Share) hash() string {
+	if s.Hash == "" {
+		return DefaultHash
+	}
+	return s.Hash
+}
+
+// RelPath returns p relative to the share root using forward slashes, so it
+// is the same on every platform.
+func (s Share) RelPath(p string) (string, error) {
+	rel, err := filepath.Rel(s.Root, p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Contains reports whether p lies inside the share root.
+func (s Share) Contains(p string) bool {
+	rel, err := s.RelPath(p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+func (s Share) baseIgnore() *Ignore {
+	ig := NewIgnore(s.Ignore)
+	ig.Add("", s.Exclude)
+	return ig
+}
+
+// Skipped reports whether the file at rel is left out of the index, either
+// by an ignore rule on it or one of its directories, or by Include.
+func (s Share) Skipped(rel string) (bool, error) {
+	if path.Base(rel) == IgnoreFileName {
+		return true, nil
+	}
+	ig, err := s.loadIgnoreChain(rel)
+	if err != nil {
+		return false, err
+	}
+	return ig.Ignored(rel, false) || !s.included(rel), nil
+}
+
+// Walk calls fn for every file of the share that is not skipped.
+// Ignored directories are not entered, and each directory's .peerfsignore
+// is read before its contents are visited.
+func (s Share) Walk(fn func(path, rel string, info os.FileInfo) error) error {
+	ig := s.baseIgnore()
+	return filepath.Walk(s.Root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := s.RelPath(p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p == s.Root {
+				rel = ""
+			} else if ig.Match(rel, true) {
+				return filepath.SkipDir
+			}
+			return ig.LoadFile(p, rel)
+		}
+		if path.Base(rel) == IgnoreFileName {
+			return nil
+		}
+		if ig.Match(rel, false) || !s.included(rel) {
+			return nil
+		}
+		return fn(p, rel, info)
+	})
+}
+
+// walkDirs calls fn for root, a directory of the share, and for every
+// entry below it, without entering ignored directories. Nothing is visited
+// if root itself is ignored.
+func (s Share) walkDirs(root string, fn func(p string, d fs.DirEntry) error) error {
+	rel, err := s.RelPath(root)
+	if err != nil {
+		return err
+	}
+	ig := s.baseIgnore()
+	if rel != "." {
+		if ig, err = s.loadIgnoreChain(rel); err != nil {
+			return err
+		}
+		if ig.Ignored(rel, true) {
+			return nil
+		}
+	}
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := s.RelPath(p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p == s.Root {
+				rel = ""
+			} else if p != root && ig.Match(rel, true) {
+				return filepath.SkipDir
+			}
+			if err := ig.LoadFile(p, rel); err != nil {
+				return err
+			}
+		}
+		return fn(p, d)
+	})
+}
+
+func (s Share) included(rel string) bool {
+	return len(s.Include) == 0 || matchAny(s.Include, rel)
+}
+
+func matchAny(patterns []string, rel string) bool {
+	base := path.Base(rel)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Share) label(meta *FileMeta, p string) {
+	meta.Share = s.Name
+	meta.RelPath, _ = s.RelPath(p)
+}
@@ -0,0 +1,192 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Store persists indexed file metadata between runs so unchanged files do
+// not have to be hashed again. Each indexed root directory gets its own
+// bucket, keyed by file path.
+type Store struct {
+	db *bolt.DB
+}
+
+type storedFile struct {
+	Meta    FileMeta
+	Size    int64
+	ModTime int64
+	Inode   uint64
+}
+
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index store %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Reset forgets everything stored for dir, forcing a full re-hash.
+func (s *Store) Reset(dir string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(bucketName(dir))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+}
+
+func (s *Store) load(dir string) (map[string]storedFile, error) {
+	records := make(map[string]storedFile)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName(dir))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var rec storedFile
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			records[string(k)] = rec
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (s *Store) get(dir, path string) (storedFile, bool, error) {
+	var rec storedFile
+	found := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketName(dir))
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(path))
+		if v == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(v, &rec)
+	})
+	return rec, found, err
+}
+
+func (s *Store) save(dir string, put map[string]storedFile, remove []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucketName(dir))
+		if err != nil {
+			return err
+		}
+		for path, rec := range put {
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(path), data); err != nil {
+				return err
+			}
+		}
+		for _, path := range remove {
+			if err := b.Delete([]byte(path)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func bucketName(dir string) []byte {
+	return []byte(filepath.Clean(dir))
+}
+
+// matches reports whether rec is still valid for the file described by
+// info when split and hashed the way share says. Records from before chunk
+// records existed have no chunking mode, and those that stored SHA-256
+// hashes as multihashes are not in normal form; both are hashed again.
+func (rec storedFile) matches(info os.FileInfo, share Share) bool {
+	return rec.Meta.Chunking == share.chunking() &&
+		rec.Meta.FileHash == NormalizeHash(rec.Meta.FileHash) &&
+		HashAlgorithm(rec.Meta.FileHash) == share.hash() &&
+		rec.Meta.ChunkSize == share.chunkSizeFor(info.Size()) &&
+		rec.Size == info.Size() &&
+		rec.ModTime == info.ModTime().UnixNano() &&
+		rec.Inode == fileID(info)
+}
+
+// Reindex indexes a share like IndexDirectory but only hashes files that
+// are new or whose size, modification time or inode changed since the last
+// run, using hasher to hash several of them at once. Files that disappeared
+// are dropped from the store.
+func Reindex(share Share, store *Store, hasher *Hasher) ([]FileMeta, error) {
+	dir := share.Root
+	records, err := store.load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load index store: %w", err)
+	}
+
+	var files []FileMeta
+	var jobs []*hashJob
+	seen := make(map[string]bool)
+
+	err = share.Walk(func(path, rel string, info os.FileInfo) error {
+		seen[path] = true
+
+		if rec, ok := records[path]; ok && rec.matches(info, share) {
+			share.label(&rec.Meta, path)
+			files = append(files, rec.Meta)
+			return nil
+		}
+		jobs = append(jobs, &hashJob{
+			path:      path,
+			info:      info,
+			chunking:  share.chunking(),
+			chunkSize: share.chunkSizeFor(info.Size()),
+			algo:      share.hash(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := hasher.hashAll(jobs); err != nil {
+		return nil, err
+	}
+
+	put := make(map[string]storedFile)
+	for _, job := range jobs {
+		share.label(&job.meta, job.path)
+		put[job.path] = storedFile{
+			Meta:    job.meta,
+			Size:    job.info.Size(),
+			ModTime: job.info.ModTime().UnixNano(),
+			Inode:   fileID(job.info),
+		}
+		files = append(files, job.meta)
+	}
+
+	var remove []string
+	for path := range records {
+		if !seen[path] {
+			remove = append(remove, path)
+		}
+	}
+	if err := store.save(dir, put, remove); err != nil {
+		return nil, fmt.Errorf("failed to update index store: %w", err)
+	}
+
+	fmt.Printf("Index of share %s (%s): %d unchanged, %d hashed, %d removed.\n", share.Name, dir, len(files)-len(jobs), len(jobs), len(remove))
+	return files, nil
+}
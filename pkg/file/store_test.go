@@ -0,0 +1,99 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReindexIncremental(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared")
+	if err := os.MkdirAll(shared, 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(shared, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.txt", "first")
+	write("b.txt", "second")
+
+	store, err := OpenStore(filepath.Join(dir, "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	share := Share{Name: "shared", Root: shared}
+	files, err := Reindex(share, store, NewHasher(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+
+	write("a.txt", "first, but changed")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(shared, "a.txt"), later, later)
+	os.Remove(filepath.Join(shared, "b.txt"))
+
+	files, err = Reindex(share, store, NewHasher(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected deleted file to be dropped, got %d files", len(files))
+	}
+	want, err := IndexDirectory(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files[0].FileHash != want[0].FileHash {
+		t.Error("Expected modified file to be re-hashed")
+	}
+
+	records, err := store.load(shared)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Errorf("Expected 1 stored record, got %d", len(records))
+	}
+}
+
+func TestReindexShareRules(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"keep.csv", "skip.tmp", "notes.txt", "cache/data.csv"} {
+		path := filepath.Join(dir, "share", filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store, err := OpenStore(filepath.Join(dir, "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	share := Share{
+		Name:    "datasets",
+		Root:    filepath.Join(dir, "share"),
+		Include: []string{"*.csv", "*.tmp"},
+		Exclude: []string{"*.tmp", "cache"},
+	}
+	files, err := Reindex(share, store, NewHasher(2, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("Expected only keep.csv to be indexed, got %d files", len(files))
+	}
+	if files[0].Share != "datasets" || files[0].RelPath != "keep.csv" {
+		t.Errorf("Expected share datasets and path keep.csv, got %s and %s", files[0].Share, files[0].RelPath)
+	}
+}
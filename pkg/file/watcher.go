@@ -0,0 +1,209 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeModified ChangeType = "modified"
+	ChangeRemoved  ChangeType = "removed"
+)
+
+type Change struct {
+	Type ChangeType `json:"type"`
+	Path string     `json:"path"`
+	Meta FileMeta   `json:"meta"`
+}
+
+// UpdatePath brings the index and store entries for a single path in share
+// in line with what is on disk: new or changed files are hashed, and a
+// missing or ignored path removes the file, or every file below it if it
+// was a directory.
+func UpdatePath(share Share, path string, store *Store, index *Index, hasher *Hasher) ([]Change, error) {
+	dir := share.Root
+	rel, err := share.RelPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Lstat(path)
+	if err == nil && info.Mode().IsRegular() {
+		skipped, skipErr := share.Skipped(rel)
+		if skipErr != nil {
+			return nil, skipErr
+		}
+		if skipped {
+			err = fs.ErrNotExist
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		var changes []Change
+		var remove []string
+		for _, meta := range index.RemovePath(share.Name, path) {
+			changes = append(changes, Change{Type: ChangeRemoved, Path: meta.Path, Meta: meta})
+			remove = append(remove, meta.Path)
+		}
+		return changes, store.save(dir, nil, remove)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	if _, ok := index.LookupPath(path); ok {
+		if rec, found, err := store.get(dir, path); err == nil && found && rec.matches(info, share) {
+			return nil, nil
+		}
+	}
+
+	meta, err := hasher.HashFile(path, info, share.chunking(), share.chunkSizeFor(info.Size()), share.hash())
+	if err != nil {
+		return nil, err
+	}
+	share.label(&meta, path)
+	rec := storedFile{
+		Meta:    meta,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   fileID(info),
+	}
+	if err := store.save(dir, map[string]storedFile{path: rec}, nil); err != nil {
+		return nil, err
+	}
+
+	change := Change{Type: ChangeAdded, Path: path, Meta: meta}
+	if index.Upsert(meta) {
+		change.Type = ChangeModified
+	}
+	return []Change{change}, nil
+}
+
+// Watcher reports paths below a share root that changed on disk. Bursts of
+// writes to the same path are collapsed into one notification once the
+// path has been quiet for the debounce interval. Directories the share
+// ignores when the watch starts or they are created are not watched.
+type Watcher struct {
+	share    Share
+	debounce time.Duration
+	fsw      *fsnotify.Watcher
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func NewWatcher(share Share, debounce time.Duration) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	w := &Watcher{
+		share:    share,
+		debounce: debounce,
+		fsw:      fsw,
+		timers:   make(map[string]*time.Timer),
+	}
+	if err := w.addTree(share.Root, nil); err != nil {
+		fsw.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// addTree watches root and every directory below it that the share does
+// not ignore, as fsnotify is not recursive on its own, and passes the files
+// found in them to onFile if it is not nil.
+func (w *Watcher) addTree(root string, onFile func(path string)) error {
+	return w.share.walkDirs(root, func(path string, d fs.DirEntry) error {
+		if d.IsDir() {
+			return w.fsw.Add(path)
+		}
+		if onFile != nil {
+			onFile(path)
+		}
+		return nil
+	})
+}
+
+// Close releases a watcher that will not be run.
+func (w *Watcher) Close() error {
+	return w.fsw.Close()
+}
+
+// Run delivers changed paths to handle until ctx is cancelled. handle is
+// called from a single goroutine at a time.
+func (w *Watcher) Run(ctx context.Context, handle func(path string)) error {
+	defer w.fsw.Close()
+
+	ready := make(chan string, 64)
+	for {
+		select {
+		case <-ctx.Done():
+			w.stopTimers()
+			return nil
+		case path := <-ready:
+			handle(path)
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Printf("Watcher error on %s: %v\n", w.share.Root, err)
+		case ev, ok := <-w.fsw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					// Files may already exist in a directory that was moved in,
+					// so queue all of them as well.
+					w.addTree(ev.Name, func(path string) {
+						w.schedule(ctx, path, ready)
+					})
+					continue
+				}
+			}
+			w.schedule(ctx, ev.Name, ready)
+		}
+	}
+}
+
+func (w *Watcher) schedule(ctx context.Context, path string, ready chan<- string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if t, ok := w.timers[path]; ok {
+		t.Reset(w.debounce)
+		return
+	}
+	w.timers[path] = time.AfterFunc(w.debounce, func() {
+		w.mu.Lock()
+		delete(w.timers, path)
+		w.mu.Unlock()
+
+		select {
+		case ready <- path:
+		case <-ctx.Done():
+		}
+	})
+}
+
+func (w *Watcher) stopTimers() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, t := range w.timers {
+		t.Stop()
+		delete(w.timers, path)
+	}
+}
@@ -0,0 +1,112 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWatcherUpdatesIndex(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared")
+	if err := os.MkdirAll(shared, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenStore(filepath.Join(dir, "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	index := NewIndex(nil)
+
+	w, err := NewWatcher(Share{Name: "shared", Root: shared}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan Change, 16)
+	go w.Run(ctx, func(path string) {
+		cs, err := UpdatePath(Share{Name: "shared", Root: shared}, path, store, index, NewHasher(1, 0))
+		if err != nil {
+			t.Error(err)
+		}
+		for _, c := range cs {
+			changes <- c
+		}
+	})
+
+	expect := func(want ChangeType) Change {
+		t.Helper()
+		select {
+		case c := <-changes:
+			if c.Type != want {
+				t.Fatalf("Expected %s change, got %s for %s", want, c.Type, c.Path)
+			}
+			return c
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for %s change", want)
+		}
+		return Change{}
+	}
+
+	path := filepath.Join(shared, "new.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	added := expect(ChangeAdded)
+	if _, ok := index.Lookup(added.Meta.FileHash); !ok {
+		t.Error("Expected added file to be in the index")
+	}
+
+	if err := os.MkdirAll(filepath.Join(shared, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := os.WriteFile(filepath.Join(shared, "sub", "nested.txt"), []byte("nested"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect(ChangeAdded)
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	expect(ChangeRemoved)
+	if index.Len() != 1 {
+		t.Errorf("Expected 1 file left in the index, got %d", index.Len())
+	}
+}
+
+func TestWatcherSkipsIgnoredDirs(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"node_modules/pkg", "docs/build", "docs/src"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", IgnoreFileName), []byte("build/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewWatcher(Share{Name: "shared", Root: root, Ignore: []string{"node_modules/"}}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	watched := w.fsw.WatchList()
+	for _, dir := range []string{"", "docs", "docs/src"} {
+		if !slices.Contains(watched, filepath.Join(root, dir)) {
+			t.Errorf("Expected %q to be watched, got %v", dir, watched)
+		}
+	}
+	for _, dir := range []string{"node_modules", "node_modules/pkg", "docs/build"} {
+		if slices.Contains(watched, filepath.Join(root, dir)) {
+			t.Errorf("Expected ignored %q not to be watched", dir)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package link encodes everything needed to fetch a shared file or
+// directory into a single peerfs:// URI:
+//
+//	peerfs://file/<hash>?name=report.pdf&size=123&root=<merkle root>&chunks=1&peer=<multiaddr>
+//	peerfs://dir/<collection hash>?name=album&size=456&peer=<multiaddr>
+//
+// peer may be repeated and holds full multiaddrs ending in /p2p/<peer id>.
+package link
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const Scheme = "peerfs"
+
+const (
+	kindFile = "file"
+	kindDir  = "dir"
+)
+
+type Link struct {
+	// Hash is the file hash, or the collection hash if Dir is set.
+	Hash string
+	Dir  bool
+	Name string
+	Size int64
+	// MerkleRoot and NumChunks are enough to download and verify a file
+	// without asking anyone for its metadata.
+	MerkleRoot string
+	NumChunks  int
+	Providers  []peer.AddrInfo
+}
+
+// FromMeta returns a link to an indexed file or directory, as returned by
+// the index or a search.
+func FromMeta(meta file.FileMeta, providers []peer.AddrInfo) Link {
+	l := Link{
+		Hash:      meta.FileHash,
+		Dir:       meta.IsDir,
+		Name:      meta.Name,
+		Size:      meta.Size,
+		Providers: providers,
+	}
+	if !meta.IsDir {
+		l.MerkleRoot = meta.MerkleRoot
+		l.NumChunks = meta.NumChunks
+	}
+	return l
+}
+
+func (l Link) String() string {
+	kind := kindFile
+	if l.Dir {
+		kind = kindDir
+	}
+	q := url.Values{}
+	if l.Name != "" {
+		q.Set("name", l.Name)
+	}
+	q.Set("size", strconv.FormatInt(l.Size, 10))
+	if l.MerkleRoot != "" {
+		q.Set("root", l.MerkleRoot)
+		q.Set("chunks", strconv.Itoa(l.NumChunks))
+	}
+	for _, info := range l.Providers {
+		addrs, err := peer.AddrInfoToP2pAddrs(&info)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			q.Add("peer", addr.String())
+		}
+	}
+	u := url.URL{Scheme: Scheme, Host: kind, Path: "/" + l.Hash, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// Parse reads a peerfs:// URI. The name is reduced to a single path element
+// so it is safe to save under.
+func Parse(s string) (Link, error) {
+	var l Link
+	u, err := url.Parse(s)
+	if err != nil {
+		return l, err
+	}
+	if u.Scheme != Scheme {
+		return l, fmt.Errorf("not a %s:// link", Scheme)
+	}
+	switch u.Host {
+	case kindFile:
+	case kindDir:
+		l.Dir = true
+	default:
+		return l, fmt.Errorf("unknown link kind %q", u.Host)
+	}
+	l.Hash = strings.TrimPrefix(u.Path, "/")
+	if _, _, err := file.DecodeHash(l.Hash); err != nil {
+		return l, err
+	}
+
+	q := u.Query()
+	if name := path.Base(q.Get("name")); name != "." && name != "/" && name != ".." {
+		l.Name = name
+	}
+	if size := q.Get("size"); size != "" {
+		if l.Size, err = strconv.ParseInt(size, 10, 64); err != nil || l.Size < 0 {
+			return l, fmt.Errorf("invalid size %q", size)
+		}
+	}
+	if root := q.Get("root"); root != "" {
+		if _, _, err := file.DecodeHash(root); err != nil {
+			return l, fmt.Errorf("invalid merkle root: %w", err)
+		}
+		l.MerkleRoot = root
+		if l.NumChunks, err = strconv.Atoi(q.Get("chunks")); err != nil || l.NumChunks < 0 {
+			return l, errors.New("merkle root given without a valid chunk count")
+		}
+	}
+
+	var addrs []ma.Multiaddr
+	for _, s := range q["peer"] {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return l, fmt.Errorf("invalid peer address %q: %w", s, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	if l.Providers, err = peer.AddrInfosFromP2pAddrs(addrs...); err != nil {
+		return l, fmt.Errorf("invalid peer address: %w", err)
+	}
+	return l, nil
+}
+
+// Meta returns the file metadata carried by a file link.
+func (l Link) Meta() file.FileMeta {
+	name := l.Name
+	if name == "" {
+		name = l.Hash
+	}
+	return file.FileMeta{
+		Name:       name,
+		Size:       l.Size,
+		FileHash:   l.Hash,
+		MerkleRoot: l.MerkleRoot,
+		NumChunks:  l.NumChunks,
+		IsDir:      l.Dir,
+	}
+}
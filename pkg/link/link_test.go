@@ -0,0 +1,67 @@
+package link
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+const testHash = "12202cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+func TestLinkRoundTrip(t *testing.T) {
+	id, err := peer.Decode("12D3KooWGzh9Fik5p1vPJ6Y2kq1gkqT3Lh2mFNW3mXrFeKq8Tr6F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ma.StringCast("/ip4/192.0.2.1/tcp/4001")
+	l := Link{
+		Hash:       testHash,
+		Name:       "my report.pdf",
+		Size:       1234,
+		MerkleRoot: testHash,
+		NumChunks:  1,
+		Providers:  []peer.AddrInfo{{ID: id, Addrs: []ma.Multiaddr{addr}}},
+	}
+
+	s := l.String()
+	if !strings.HasPrefix(s, "peerfs://file/"+testHash+"?") {
+		t.Errorf("Unexpected link %s", s)
+	}
+	got, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Hash != l.Hash || got.Name != l.Name || got.Size != l.Size || got.MerkleRoot != l.MerkleRoot || got.NumChunks != 1 || got.Dir {
+		t.Errorf("Round trip changed the link: %+v", got)
+	}
+	if len(got.Providers) != 1 || got.Providers[0].ID != id || !got.Providers[0].Addrs[0].Equal(addr) {
+		t.Errorf("Unexpected providers: %+v", got.Providers)
+	}
+}
+
+func TestParseRejectsBadLinks(t *testing.T) {
+	for _, s := range []string{
+		"http://file/" + testHash,
+		"peerfs://blob/" + testHash,
+		"peerfs://file/not-a-hash",
+		"peerfs://file/" + testHash + "?size=-1",
+		"peerfs://file/" + testHash + "?root=" + testHash,
+		"peerfs://dir/" + testHash + "?peer=/ip4/192.0.2.1/tcp/4001",
+	} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Expected %s to be rejected", s)
+		}
+	}
+}
+
+func TestParseSanitizesName(t *testing.T) {
+	l, err := Parse("peerfs://dir/" + testHash + "?name=..%2F..%2Fetc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Name != "etc" || !l.Dir {
+		t.Errorf("Expected name etc for a dir link, got %+v", l)
+	}
+}
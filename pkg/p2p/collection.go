@@ -0,0 +1,79 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// CollectionProtocol serves the manifest of a shared directory, addressed
+// by its collection hash.
+const CollectionProtocol = "/go-peerfs/collection/1.0.0"
+
+// maxCollectionSize caps a collection manifest, enough for a directory
+// tree of a few hundred thousand files.
+const maxCollectionSize = 64 << 20
+
+func SetCollectionHandler(h host.Host, idx Index) {
+	h.SetStreamHandler(CollectionProtocol, func(s network.Stream) {
+		collectionStreamHandler(s, idx)
+	})
+	fmt.Println("Collection stream handler set.")
+}
+
+func collectionStreamHandler(s network.Stream, idx Index) {
+	defer s.Close()
+
+	hash, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil {
+		fmt.Printf("Error reading from stream: %v\n", err)
+		return
+	}
+	hash = strings.TrimSpace(hash)
+
+	_, coll, ok := idx.LookupCollection(hash)
+	if !ok {
+		fmt.Printf("Collection %s not found.\n", hash)
+		return
+	}
+	if _, err := s.Write(coll.Encode()); err != nil {
+		fmt.Printf("Error sending collection: %v\n", err)
+	}
+}
+
+// RequestCollection fetches a collection manifest and checks it against
+// its hash.
+func RequestCollection(ctx context.Context, h host.Host, peerID peer.ID, hash string) (file.Collection, error) {
+	streamCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	s, err := h.NewStream(streamCtx, peerID, CollectionProtocol)
+	if err != nil {
+		return file.Collection{}, err
+	}
+	defer s.Close()
+
+	if _, err := s.Write([]byte(hash + "\n")); err != nil {
+		return file.Collection{}, err
+	}
+	s.CloseWrite()
+
+	data, err := io.ReadAll(io.LimitReader(s, maxCollectionSize+1))
+	if err != nil {
+		return file.Collection{}, err
+	}
+	if len(data) > maxCollectionSize {
+		return file.Collection{}, fmt.Errorf("collection %s from peer %s is larger than %d bytes", hash, peerID, maxCollectionSize)
+	}
+	if len(data) == 0 {
+		return file.Collection{}, fmt.Errorf("peer %s does not have collection %s", peerID, hash)
+	}
+	return file.DecodeCollection(hash, data)
+}
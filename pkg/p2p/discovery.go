@@ -15,8 +15,6 @@ import (
 	dutil "github.com/libp2p/go-libp2p/p2p/discovery/util"
 )
 
-const rendezvousString = "go-peerfs-rendezvous"
-
 type notifee struct {
 	h host.Host
 }
@@ -27,27 +25,33 @@ func (n *notifee) HandlePeerFound(pi peer.AddrInfo) {
 	}
 	fmt.Printf("Found Peer via mDNS: %s\n", pi.ID.String())
 	if err := n.h.Connect(context.Background(), pi); err != nil {
-		fmt.Printf("Failed to connect to mDNS peer %s: %s\n", pi.ID.String())
+		fmt.Printf("Failed to connect to mDNS peer %s: %s\n", pi.ID.String(), err)
 	} else {
 		fmt.Printf("Connected to mDNS peer: %s\n", pi.ID.String())
 	}
 }
 
-func DiscoveryService(ctx context.Context, h host.Host) error {
+// NewDHT creates the node's DHT, used both to find peers and to announce
+// and look up the files they provide.
+func NewDHT(ctx context.Context, h host.Host) (*dht.IpfsDHT, error) {
+	kadDHT, err := dht.New(ctx, h, dht.Mode(dht.ModeServer))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DHT: %w", err)
+	}
+	return kadDHT, nil
+}
+
+func DiscoveryService(ctx context.Context, h host.Host, kadDHT *dht.IpfsDHT, rendezvousString string) error {
 	fmt.Println("Starting mDNS for local discovery...")
 	mdnsService := mdns.NewMdnsService(h, rendezvousString, &notifee{h: h})
 	if err := mdnsService.Start(); err != nil {
 		return fmt.Errorf("failed to start mDNS: %w", err)
 	}
+	defer mdnsService.Close()
 	fmt.Println("mDNS started successfully.")
 
-	kadDHT, err := dht.New(ctx, h, dht.Mode(dht.ModeServer))
-	if err != nil {
-		return fmt.Errorf("failed to create DHT: %w", err)
-	}
-
 	fmt.Println("Bootstrapping the DHT...")
-	if err = kadDHT.Bootstrap(ctx); err != nil {
+	if err := kadDHT.Bootstrap(ctx); err != nil {
 		return fmt.Errorf("failed to bootstrap DHT: %w", err)
 	}
 
@@ -0,0 +1,69 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// HaveProtocol asks a peer whether it serves a file or collection hash. It
+// is much cheaper than fetching metadata, so a downloader can ask every
+// peer it is connected to.
+const HaveProtocol = "/go-peerfs/have/1.0.0"
+
+func SetHaveHandler(h host.Host, idx Index) {
+	h.SetStreamHandler(HaveProtocol, func(s network.Stream) {
+		haveStreamHandler(s, idx)
+	})
+	fmt.Println("Have stream handler set.")
+}
+
+func haveStreamHandler(s network.Stream, idx Index) {
+	defer s.Close()
+
+	hash, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil {
+		fmt.Printf("Error reading from stream: %v\n", err)
+		return
+	}
+	hash = strings.TrimSpace(hash)
+
+	answer := "0\n"
+	if _, ok := idx.Lookup(hash); ok {
+		answer = "1\n"
+	} else if _, _, ok := idx.LookupCollection(hash); ok {
+		answer = "1\n"
+	}
+	if _, err := s.Write([]byte(answer)); err != nil {
+		fmt.Printf("Error sending have answer: %v\n", err)
+	}
+}
+
+// RequestHave reports whether peerID serves hash.
+func RequestHave(ctx context.Context, h host.Host, peerID peer.ID, hash string) (bool, error) {
+	streamCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	s, err := h.NewStream(streamCtx, peerID, HaveProtocol)
+	if err != nil {
+		return false, err
+	}
+	defer s.Close()
+	s.SetDeadline(time.Now().Add(10 * time.Second))
+
+	if _, err := s.Write([]byte(hash + "\n")); err != nil {
+		return false, err
+	}
+	s.CloseWrite()
+
+	answer, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(answer) == "1", nil
+}
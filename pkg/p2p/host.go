@@ -3,21 +3,117 @@ package p2p
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	"github.com/libp2p/go-libp2p/p2p/transport/websocket"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+
+	quic "github.com/libp2p/go-libp2p/p2p/transport/quic"
 )
 
-func Host(ctx context.Context) (host.Host, error) {
+// DefaultListenAddrs listens on every interface over TCP, QUIC-v1 and
+// WebSocket. Port 0 picks a random free port on each start; pass fixed
+// ports through HostConfig.ListenAddrs when firewall rules need them.
+var DefaultListenAddrs = []string{
+	"/ip4/0.0.0.0/tcp/0",
+	"/ip4/0.0.0.0/udp/0/quic-v1",
+	"/ip4/0.0.0.0/tcp/0/ws",
+	"/ip6/::/tcp/0",
+	"/ip6/::/udp/0/quic-v1",
+	"/ip6/::/tcp/0/ws",
+}
+
+type HostConfig struct {
+	PrivKey     crypto.PrivKey
+	ListenAddrs []string
+	// Announce, when set, replaces the addresses advertised to other peers.
+	Announce []string
+	// NoAnnounce drops matching addresses from what is advertised. Entries
+	// are either exact multiaddrs or CIDR filters like /ip4/10.0.0.0/ipcidr/8.
+	NoAnnounce []string
+}
+
+func Host(ctx context.Context, cfg HostConfig) (host.Host, error) {
+	listenAddrs := cfg.ListenAddrs
+	if len(listenAddrs) == 0 {
+		listenAddrs = DefaultListenAddrs
+	}
+
+	addrsFactory, err := announceFilter(cfg.Announce, cfg.NoAnnounce)
+	if err != nil {
+		return nil, err
+	}
+
 	host, err := libp2p.New(
-		libp2p.ListenAddrStrings("/ip4/0.0.0.0/tcp/0"),
+		libp2p.Identity(cfg.PrivKey),
+		libp2p.ListenAddrStrings(listenAddrs...),
+		libp2p.Transport(tcp.NewTCPTransport),
+		libp2p.Transport(quic.NewTransport),
+		libp2p.Transport(websocket.New),
+		libp2p.AddrsFactory(addrsFactory),
 	)
 	if err != nil {
 		return nil, err
 	}
 	fmt.Printf("Host Created with Id: %s\n", host.ID())
 
-	fmt.Println("Listen Addresses: ", host.Addrs())
+	fmt.Println("Listen Addresses: ", host.Network().ListenAddresses())
+	fmt.Println("Announced Addresses: ", AnnouncedAddrs(host))
 
 	return host, nil
 }
+
+// AnnouncedAddrs returns the addresses h advertises to other peers: its
+// listen addresses passed through the AddrsFactory built from the announce
+// and no-announce settings.
+func AnnouncedAddrs(h host.Host) []ma.Multiaddr {
+	return h.Addrs()
+}
+
+func announceFilter(announce, noAnnounce []string) (func([]ma.Multiaddr) []ma.Multiaddr, error) {
+	var announceAddrs []ma.Multiaddr
+	for _, s := range announce {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid announce address %q: %w", s, err)
+		}
+		announceAddrs = append(announceAddrs, addr)
+	}
+
+	filters := ma.NewFilters()
+	blocked := make(map[string]bool)
+	for _, s := range noAnnounce {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid no-announce address %q: %w", s, err)
+		}
+		if strings.Contains(s, "/ipcidr/") {
+			ipnet, err := manet.MultiaddrToIPNet(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid no-announce filter %q: %w", s, err)
+			}
+			filters.AddFilter(*ipnet, ma.ActionDeny)
+			continue
+		}
+		blocked[addr.String()] = true
+	}
+
+	return func(addrs []ma.Multiaddr) []ma.Multiaddr {
+		if len(announceAddrs) > 0 {
+			addrs = announceAddrs
+		}
+		var out []ma.Multiaddr
+		for _, addr := range addrs {
+			if blocked[addr.String()] || filters.AddrBlocked(addr) {
+				continue
+			}
+			out = append(out, addr)
+		}
+		return out
+	}, nil
+}
@@ -0,0 +1,37 @@
+package p2p
+
+import (
+	"testing"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestAnnounceFilter(t *testing.T) {
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/10.1.2.3/tcp/4001"),
+		ma.StringCast("/ip4/127.0.0.1/tcp/4001"),
+		ma.StringCast("/ip4/203.0.113.7/udp/4001/quic-v1"),
+	}
+
+	filter, err := announceFilter(nil, []string{"/ip4/10.0.0.0/ipcidr/8", "/ip4/127.0.0.1/tcp/4001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filter(addrs)
+	if len(out) != 1 || out[0].String() != "/ip4/203.0.113.7/udp/4001/quic-v1" {
+		t.Errorf("Expected only the public address, got %v", out)
+	}
+
+	filter, err = announceFilter([]string{"/dns4/peer.example.com/tcp/4001"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = filter(addrs)
+	if len(out) != 1 || out[0].String() != "/dns4/peer.example.com/tcp/4001" {
+		t.Errorf("Expected announce address to replace listen addresses, got %v", out)
+	}
+
+	if _, err := announceFilter([]string{"not-an-addr"}, nil); err == nil {
+		t.Error("Expected error for invalid announce address")
+	}
+}
@@ -0,0 +1,157 @@
+package p2p
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+)
+
+const identityFile = "identity.key"
+
+// IdentityPath returns where the node's private key lives inside dataDir.
+func IdentityPath(dataDir string) string {
+	return filepath.Join(dataDir, identityFile)
+}
+
+// LoadOrCreateIdentity reads the node key from dataDir, generating and
+// persisting a new Ed25519 key the first time the node is started.
+func LoadOrCreateIdentity(dataDir string) (crypto.PrivKey, error) {
+	priv, err := LoadIdentity(dataDir)
+	if err == nil {
+		return priv, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	priv, err = GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveIdentity(dataDir, priv); err != nil {
+		return nil, err
+	}
+	fmt.Printf("Generated new node identity in %s\n", IdentityPath(dataDir))
+	return priv, nil
+}
+
+func GenerateIdentity() (crypto.PrivKey, error) {
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate identity key: %w", err)
+	}
+	return priv, nil
+}
+
+func LoadIdentity(dataDir string) (crypto.PrivKey, error) {
+	path := IdentityPath(dataDir)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("identity key %s is accessible by other users (mode %s), run chmod 600", path, info.Mode().Perm())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse identity key %s: %w", path, err)
+	}
+	return priv, nil
+}
+
+// SaveIdentity atomically replaces the key in dataDir. The directory is
+// created with 0700 and the key file with 0600 permissions.
+func SaveIdentity(dataDir string, priv crypto.PrivKey) error {
+	tmp, err := writeIdentityTemp(dataDir, priv)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Rename(tmp, IdentityPath(dataDir))
+}
+
+// RotateIdentity replaces the key in dataDir with a new one, keeping the
+// previous key next to it with an .old suffix. The new key is written
+// before the old one is moved, so a failure leaves the node its identity.
+func RotateIdentity(dataDir string) (crypto.PrivKey, error) {
+	priv, err := GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := writeIdentityTemp(dataDir, priv)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	path := IdentityPath(dataDir)
+	if _, err := os.Stat(path); err == nil {
+		if err := os.Rename(path, path+".old"); err != nil {
+			return nil, fmt.Errorf("failed to back up old key: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Rename(path+".old", path)
+		return nil, err
+	}
+	return priv, nil
+}
+
+// writeIdentityTemp writes priv to a new 0600 file in dataDir and returns
+// its path.
+func writeIdentityTemp(dataDir string, priv crypto.PrivKey) (string, error) {
+	data, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode identity key: %w", err)
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dataDir, identityFile+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	if err := tmp.Chmod(0600); err == nil {
+		_, err = tmp.Write(data)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// ExportIdentity encodes a key as a single base64 line suitable for copying
+// between machines.
+func ExportIdentity(priv crypto.PrivKey) (string, error) {
+	data, err := crypto.MarshalPrivateKey(priv)
+	if err != nil {
+		return "", err
+	}
+	return crypto.ConfigEncodeKey(data), nil
+}
+
+func ImportIdentity(encoded string) (crypto.PrivKey, error) {
+	data, err := crypto.ConfigDecodeKey(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid exported key: %w", err)
+	}
+	priv, err := crypto.UnmarshalPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exported key: %w", err)
+	}
+	return priv, nil
+}
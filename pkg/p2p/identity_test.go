@@ -0,0 +1,30 @@
+package p2p
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRotateIdentity(t *testing.T) {
+	dir := t.TempDir()
+	old, err := LoadOrCreateIdentity(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := RotateIdentity(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadIdentity(dir)
+	if err != nil || !loaded.Equals(priv) {
+		t.Errorf("Expected the new key to be in place, got %v", err)
+	}
+	if loaded.Equals(old) {
+		t.Error("Expected a different key after rotating")
+	}
+	if _, err := os.Stat(IdentityPath(dir) + ".old"); err != nil {
+		t.Errorf("Expected the old key to be kept: %v", err)
+	}
+
+}
@@ -0,0 +1,130 @@
+package p2p
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// MetaProtocol serves the metadata of a file, with all its chunk records,
+// by file hash or Merkle root.
+const MetaProtocol = "/go-peerfs/meta/1.0.0"
+
+// maxMetaSize caps a metadata response, enough for the chunk records of a
+// file of several hundred GiB in 1 MiB chunks.
+const maxMetaSize = 64 << 20
+
+type MetaResponse struct {
+	Meta  file.FileMeta
+	Error string `json:",omitempty"`
+}
+
+func SetMetaHandler(h host.Host, idx Index) {
+	h.SetStreamHandler(MetaProtocol, func(s network.Stream) {
+		metaStreamHandler(s, idx)
+	})
+	fmt.Println("Meta stream handler set.")
+}
+
+func metaStreamHandler(s network.Stream, idx Index) {
+	defer s.Close()
+
+	hash, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil {
+		fmt.Printf("Error reading from stream: %v\n", err)
+		return
+	}
+	hash = strings.TrimSpace(hash)
+
+	var resp MetaResponse
+	if meta, ok := idx.Lookup(hash); ok {
+		// Where the file lives on this node is none of the peer's business.
+		resp.Meta = file.FileMeta{
+			Name:       meta.Name,
+			Size:       meta.Size,
+			FileHash:   meta.FileHash,
+			MerkleRoot: meta.MerkleRoot,
+			NumChunks:  meta.NumChunks,
+			Chunking:   meta.Chunking,
+			ChunkSize:  meta.ChunkSize,
+			Chunks:     meta.Chunks,
+		}
+	} else {
+		resp.Error = fmt.Sprintf("file %s not found", hash)
+	}
+	if err := json.NewEncoder(s).Encode(resp); err != nil {
+		fmt.Printf("Error sending metadata: %v\n", err)
+	}
+}
+
+// RequestMeta asks a peer for the metadata of the file with the given hash
+// or Merkle root, and checks that its chunk records add up to the file and
+// produce its Merkle root. The file hash itself can only be checked once
+// the content is downloaded.
+func RequestMeta(ctx context.Context, h host.Host, peerID peer.ID, hash string) (file.FileMeta, error) {
+	streamCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	s, err := h.NewStream(streamCtx, peerID, MetaProtocol)
+	if err != nil {
+		return file.FileMeta{}, err
+	}
+	defer s.Close()
+
+	if _, err := s.Write([]byte(hash + "\n")); err != nil {
+		return file.FileMeta{}, err
+	}
+	s.CloseWrite()
+
+	var resp MetaResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxMetaSize)).Decode(&resp); err != nil {
+		return file.FileMeta{}, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if resp.Error != "" {
+		return file.FileMeta{}, errors.New(resp.Error)
+	}
+	meta := resp.Meta
+	want := file.NormalizeHash(hash)
+	if file.NormalizeHash(meta.FileHash) != want && file.NormalizeHash(meta.MerkleRoot) != want {
+		return file.FileMeta{}, fmt.Errorf("peer sent metadata for another file")
+	}
+	if err := verifyMeta(meta); err != nil {
+		return file.FileMeta{}, fmt.Errorf("invalid metadata from %s: %w", peerID, err)
+	}
+	return meta, nil
+}
+
+// verifyMeta checks that meta's chunk records cover the file end to end
+// and produce its Merkle root.
+func verifyMeta(meta file.FileMeta) error {
+	if len(meta.Chunks) != meta.NumChunks {
+		return fmt.Errorf("%d chunk records for %d chunks", len(meta.Chunks), meta.NumChunks)
+	}
+	var offset int64
+	for i, c := range meta.Chunks {
+		if c.Offset != offset || c.Length <= 0 {
+			return fmt.Errorf("chunk %d does not follow the previous one", i)
+		}
+		offset += c.Length
+	}
+	if offset != meta.Size {
+		return fmt.Errorf("chunks cover %d bytes of %d", offset, meta.Size)
+	}
+	tree, err := file.MerkleTreeFromHex(meta.ChunkHashes())
+	if err != nil {
+		return err
+	}
+	if tree.RootHash() != file.NormalizeHash(meta.MerkleRoot) {
+		return errors.New("chunk hashes do not produce the merkle root")
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package p2p
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+func TestVerifyMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(path, make([]byte, 3*file.MinChunkSize+5), 0644); err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(path)
+	meta, err := file.NewHasher(1, 0).HashFile(path, info, file.ChunkingFixed, file.MinChunkSize, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyMeta(meta); err != nil {
+		t.Fatalf("Valid metadata rejected: %v", err)
+	}
+
+	swapped := meta
+	swapped.Chunks = append([]file.ChunkRecord(nil), meta.Chunks...)
+	swapped.Chunks[0].Hash = meta.Chunks[3].Hash
+	if verifyMeta(swapped) == nil {
+		t.Error("Expected a chunk hash not matching the root to be rejected")
+	}
+
+	short := meta
+	short.Size++
+	if verifyMeta(short) == nil {
+		t.Error("Expected chunks not covering the file to be rejected")
+	}
+}
@@ -0,0 +1,128 @@
+package p2p
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// ProofProtocol serves parts of a file's Merkle tree: the chunk records
+// below one node together with the sibling hashes up to the root.
+const ProofProtocol = "/go-peerfs/proof/1.0.0"
+
+// maxProofSize caps a proof request or response, far more than the chunk
+// records and sibling hashes of the subtrees downloads ask for.
+const maxProofSize = 16 << 20
+
+type ProofRequest struct {
+	FileHash string
+	Level    int
+	Index    int
+}
+
+type ProofResponse struct {
+	Chunks []file.ChunkRecord
+	Proof  []string
+	Error  string `json:",omitempty"`
+}
+
+func SetProofHandler(h host.Host, idx Index) {
+	h.SetStreamHandler(ProofProtocol, func(s network.Stream) {
+		proofStreamHandler(s, idx)
+	})
+	fmt.Println("Proof stream handler set.")
+}
+
+func proofStreamHandler(s network.Stream, idx Index) {
+	defer s.Close()
+
+	var req ProofRequest
+	if err := json.NewDecoder(io.LimitReader(s, maxProofSize)).Decode(&req); err != nil {
+		fmt.Printf("Error reading proof request: %v\n", err)
+		return
+	}
+
+	resp, err := subtreeProof(idx, req)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	if err := json.NewEncoder(s).Encode(resp); err != nil {
+		fmt.Printf("Error sending proof: %v\n", err)
+	}
+}
+
+func subtreeProof(idx Index, req ProofRequest) (ProofResponse, error) {
+	meta, ok := idx.Lookup(req.FileHash)
+	if !ok {
+		return ProofResponse{}, fmt.Errorf("file %s not found", req.FileHash)
+	}
+	tree, err := file.MerkleTreeFromHex(meta.ChunkHashes())
+	if err != nil {
+		return ProofResponse{}, err
+	}
+	leaves, proof, err := tree.Subtree(req.Level, req.Index)
+	if err != nil {
+		return ProofResponse{}, err
+	}
+	start := req.Index << req.Level
+	chunks := meta.Chunks[start : start+len(leaves)]
+	return ProofResponse{Chunks: chunks, Proof: encodeHashes(proof)}, nil
+}
+
+// RequestProof fetches the chunk records below node (level, index) of a
+// file's Merkle tree. The caller verifies them with file.VerifySubtree.
+func RequestProof(ctx context.Context, h host.Host, peerID peer.ID, fileHash string, level, index int) (chunks []file.ChunkRecord, proof [][]byte, err error) {
+	streamCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	s, err := h.NewStream(streamCtx, peerID, ProofProtocol)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.Close()
+
+	if err := json.NewEncoder(s).Encode(ProofRequest{FileHash: fileHash, Level: level, Index: index}); err != nil {
+		return nil, nil, err
+	}
+	s.CloseWrite()
+
+	var resp ProofResponse
+	if err := json.NewDecoder(io.LimitReader(s, maxProofSize)).Decode(&resp); err != nil {
+		return nil, nil, fmt.Errorf("failed to read proof: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, nil, errors.New(resp.Error)
+	}
+	if proof, err = decodeHashes(resp.Proof); err != nil {
+		return nil, nil, err
+	}
+	return resp.Chunks, proof, nil
+}
+
+func encodeHashes(hashes [][]byte) []string {
+	out := make([]string, len(hashes))
+	for i, h := range hashes {
+		out[i] = hex.EncodeToString(h)
+	}
+	return out
+}
+
+func decodeHashes(hashes []string) ([][]byte, error) {
+	out := make([][]byte, len(hashes))
+	for i, h := range hashes {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash in proof: %w", err)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
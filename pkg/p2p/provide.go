@@ -0,0 +1,149 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/ipfs/go-cid"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/peer"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// HashCID wraps a file, directory or chunk hash in a CIDv1 with the raw
+// codec, the key its provider records are stored under in the DHT.
+func HashCID(hash string) (cid.Cid, error) {
+	code, digest, err := file.DecodeHash(hash)
+	if err != nil {
+		return cid.Undef, err
+	}
+	m, err := mh.Encode(digest, code)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid hash %q: %w", hash, err)
+	}
+	return cid.NewCidV1(cid.Raw, m), nil
+}
+
+// Provider announces this node as a provider of hashes in the DHT, once at
+// start and again every interval so the records do not expire.
+type Provider struct {
+	dht      *dht.IpfsDHT
+	interval time.Duration
+	// keys returns the hashes to announce.
+	keys func() []string
+}
+
+func NewProvider(kadDHT *dht.IpfsDHT, interval time.Duration, keys func() []string) *Provider {
+	return &Provider{dht: kadDHT, interval: interval, keys: keys}
+}
+
+// provideRetryMin and provideRetryMax bound the wait before another round
+// when the routing table is still empty or a round failed.
+const (
+	provideRetryMin = time.Second
+	provideRetryMax = time.Minute
+)
+
+// Run announces every key until ctx is done. Until the node has peers in
+// its routing table, and after a failed round, it tries again with a
+// growing backoff instead of waiting a whole interval.
+func (p *Provider) Run(ctx context.Context) {
+	retry := provideRetryMin
+	for {
+		ok := p.dht.RoutingTable().Size() > 0
+		if ok {
+			if err := p.Provide(ctx, p.keys()); err != nil {
+				fmt.Printf("Failed to provide records: %v\n", err)
+				ok = false
+			}
+		}
+		wait := p.interval
+		if ok {
+			retry = provideRetryMin
+		} else {
+			wait = retry
+			retry = min(retry*2, provideRetryMax)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// provideWorkers bounds how many provider records are published at once.
+const provideWorkers = 8
+
+// Provide announces hashes now. It returns the last error, if any, after
+// trying all of them.
+func (p *Provider) Provide(ctx context.Context, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	queue := make(chan string)
+	var mu sync.Mutex
+	var lastErr error
+	failed := 0
+	var wg sync.WaitGroup
+	for i := 0; i < min(provideWorkers, len(hashes)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hash := range queue {
+				err := p.provide(ctx, hash)
+				if err != nil {
+					mu.Lock()
+					lastErr = err
+					failed++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, hash := range hashes {
+		select {
+		case queue <- hash:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+	wg.Wait()
+	if lastErr != nil {
+		return fmt.Errorf("%d of %d records failed: %w", failed, len(hashes), lastErr)
+	}
+	fmt.Printf("Provided %d records to the DHT.\n", len(hashes))
+	return nil
+}
+
+func (p *Provider) provide(ctx context.Context, hash string) error {
+	c, err := HashCID(hash)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	return p.dht.Provide(ctx, c, true)
+}
+
+// FindProviders looks up at most limit peers that announced hash in the
+// DHT, leaving out this node.
+func FindProviders(ctx context.Context, kadDHT *dht.IpfsDHT, hash string, limit int) ([]peer.AddrInfo, error) {
+	c, err := HashCID(hash)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var providers []peer.AddrInfo
+	for info := range kadDHT.FindProvidersAsync(ctx, c, limit) {
+		if info.ID != kadDHT.Host().ID() {
+			providers = append(providers, info)
+		}
+	}
+	return providers, nil
+}
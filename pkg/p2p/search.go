@@ -15,13 +15,14 @@ import (
 
 const SearchProtocol = "/go-peerfs/search/1.0.0"
 
-func SetSearchHandler(h host.Host, files []file.FileMeta) {
-	fileIndex = files
-	h.SetStreamHandler(SearchProtocol, searchStreamHandler)
+func SetSearchHandler(h host.Host, idx Index) {
+	h.SetStreamHandler(SearchProtocol, func(s network.Stream) {
+		searchStreamHandler(s, idx)
+	})
 	fmt.Println("Search Stream Handler set.")
 }
 
-func searchStreamHandler(s network.Stream) {
+func searchStreamHandler(s network.Stream, idx Index) {
 	defer s.Close()
 
 	reader := bufio.NewReader(s)
@@ -31,9 +32,12 @@ func searchStreamHandler(s network.Stream) {
 		return
 	}
 	query = query[:len(query)-1]
-	fmt.Printf("Received Search Query '%s' from %s\n", err)
+	fmt.Printf("Received Search Query '%s' from %s\n", query, s.Conn().RemotePeer())
 
-	results := file.SearchLocal(fileIndex, query)
+	results := idx.Search(query)
+	for i := range results {
+		results[i] = results[i].Summary()
+	}
 
 	encoder := json.NewEncoder(s)
 
@@ -14,19 +14,37 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 )
 
 const FileTransferProtocol = "/go-peerfs/transfer/1.0.0"
 
-var fileIndex []file.FileMeta
+// ChunkProtocol serves a single chunk addressed by its hash, whichever file
+// it is found in.
+const ChunkProtocol = "/go-peerfs/chunk/1.0.0"
+
+// Index is the set of local files a node serves to other peers. Block
+// returns a chunk kept in the node's block store, if it has one, so a
+// chunk can still be served when the file it came from changed on disk.
+type Index interface {
+	Lookup(hash string) (file.FileMeta, bool)
+	LookupChunk(hash string) (file.FileMeta, file.ChunkRecord, bool)
+	LookupCollection(hash string) (file.FileMeta, file.Collection, bool)
+	Block(hash string) ([]byte, bool)
+	Search(query string) []file.FileMeta
+}
 
-func SetStreamHandler(h host.Host, files []file.FileMeta) {
-	fileIndex = files
-	h.SetStreamHandler(FileTransferProtocol, fileStreamHandler)
+func SetStreamHandler(h host.Host, idx Index) {
+	h.SetStreamHandler(FileTransferProtocol, func(s network.Stream) {
+		fileStreamHandler(s, idx)
+	})
+	h.SetStreamHandler(ChunkProtocol, func(s network.Stream) {
+		chunkStreamHandler(s, idx)
+	})
 	fmt.Println("File Transfer stream handler set.")
 }
 
-func fileStreamHandler(s network.Stream) {
+func fileStreamHandler(s network.Stream, idx Index) {
 	fmt.Printf("New incoming stream from %s\n", s.Conn().RemotePeer())
 	defer s.Close()
 
@@ -55,43 +73,68 @@ func fileStreamHandler(s network.Stream) {
 	}
 	fmt.Printf("Peer %s is requesting chunk %d for file %s\n", s.Conn().RemotePeer(), chunkIndex, fileHash)
 
-	var requestedFile *file.FileMeta
-
-	for _, f := range fileIndex {
-		if f.FileHash == fileHash {
-			requestedFile = &f
-			break
-		}
-	}
-
-	if requestedFile == nil {
+	requestedFile, ok := idx.Lookup(fileHash)
+	if !ok {
 		fmt.Printf("File with hash %s not found.\n", fileHash)
 		return
 	}
-	f, err := os.Open(requestedFile.Path)
-	if err != nil {
-		fmt.Printf("Error opening file %s: %v\n", requestedFile.Path, err)
+	if chunkIndex < 0 || chunkIndex >= len(requestedFile.Chunks) {
+		fmt.Printf("File %s has no chunk %d.\n", fileHash, chunkIndex)
 		return
 	}
+	if _, err := sendChunk(s, requestedFile, requestedFile.Chunks[chunkIndex]); err != nil {
+		fmt.Println(err)
+	}
+}
 
-	defer f.Close()
-
-	offset := int64(chunkIndex) * file.ChunkSize
-	f.Seek(offset, 0)
+func chunkStreamHandler(s network.Stream, idx Index) {
+	defer s.Close()
 
-	chunkReader := io.LimitedReader{
-		R: f,
-		N: file.ChunkSize,
+	chunkHash, err := bufio.NewReader(s).ReadString('\n')
+	if err != nil {
+		fmt.Printf("Error reading from stream: %v\n", err)
+		return
 	}
-	bytesSent, err := io.Copy(s, &chunkReader)
+	chunkHash = strings.TrimSpace(chunkHash)
 
-	if err != nil {
+	if meta, chunk, ok := idx.LookupChunk(chunkHash); ok {
+		sent, err := sendChunk(s, meta, chunk)
+		if err == nil {
+			return
+		}
+		fmt.Println(err)
+		if sent > 0 {
+			return
+		}
+	}
+	data, ok := idx.Block(chunkHash)
+	if !ok {
+		fmt.Printf("Chunk %s not found.\n", chunkHash)
+		return
+	}
+	if _, err := s.Write(data); err != nil {
 		fmt.Printf("Error Sending Chunk: %v\n", err)
 		return
 	}
+	fmt.Printf("Finished sending chunk %s from the block store. Sent %d bytes.\n", chunkHash, len(data))
+}
 
-	fmt.Printf("Finished sending chunk %d. Sent %d bytes.\n", chunkIndex, bytesSent)
+// sendChunk copies a chunk of a shared file to s and returns how many bytes
+// were sent. If it fails before sending anything, the chunk can still be
+// served from elsewhere.
+func sendChunk(s network.Stream, meta file.FileMeta, chunk file.ChunkRecord) (int64, error) {
+	f, err := os.Open(meta.Path)
+	if err != nil {
+		return 0, fmt.Errorf("error opening file %s: %w", meta.Path, err)
+	}
+	defer f.Close()
 
+	bytesSent, err := io.Copy(s, io.NewSectionReader(f, chunk.Offset, chunk.Length))
+	if err != nil {
+		return bytesSent, fmt.Errorf("error sending chunk %s of %s: %w", chunk.Hash, meta.Name, err)
+	}
+	fmt.Printf("Finished sending chunk %s of %s. Sent %d bytes.\n", chunk.Hash, meta.Name, bytesSent)
+	return bytesSent, nil
 }
 
 func RequestFile(ctx context.Context, h host.Host, peerID peer.ID, meta file.FileMeta, savePath string) error {
@@ -130,15 +173,29 @@ func RequestFile(ctx context.Context, h host.Host, peerID peer.ID, meta file.Fil
 }
 
 func RequestChunk(ctx context.Context, h host.Host, peerID peer.ID, fileHash string, chunkIndex int) ([]byte, error) {
-	request := fmt.Sprintf("%s:%d\n", fileHash, chunkIndex)
+	return requestChunk(ctx, h, peerID, FileTransferProtocol, fmt.Sprintf("%s:%d\n", fileHash, chunkIndex))
+}
+
+// RequestChunkByHash fetches one chunk by its hash. The caller verifies the
+// data against the hash.
+func RequestChunkByHash(ctx context.Context, h host.Host, peerID peer.ID, chunkHash string) ([]byte, error) {
+	return requestChunk(ctx, h, peerID, ChunkProtocol, chunkHash+"\n")
+}
+
+func requestChunk(ctx context.Context, h host.Host, peerID peer.ID, proto protocol.ID, request string) ([]byte, error) {
 	streamCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
-	s, err := h.NewStream(streamCtx, peerID, FileTransferProtocol)
+	s, err := h.NewStream(streamCtx, peerID, proto)
 	if err != nil {
 		return nil, err
 	}
 
 	defer s.Close()
+	// The caller's deadline bounds the whole transfer, not just opening
+	// the stream, so a stalled peer cannot hold the request forever.
+	if deadline, ok := ctx.Deadline(); ok {
+		s.SetDeadline(deadline)
+	}
 
 	_, err = s.Write([]byte(request))
 
@@ -147,10 +204,13 @@ func RequestChunk(ctx context.Context, h host.Host, peerID peer.ID, fileHash str
 	}
 
 	s.CloseWrite()
-	chunkData, err := io.ReadAll(s)
+	chunkData, err := io.ReadAll(io.LimitReader(s, file.MaxChunkSize+1))
 	if err != nil {
 		return nil, err
 	}
+	if len(chunkData) > file.MaxChunkSize {
+		return nil, fmt.Errorf("chunk from peer %s is larger than %d bytes", peerID, file.MaxChunkSize)
+	}
 	return chunkData, nil
 
 }
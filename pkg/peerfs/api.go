@@ -0,0 +1,482 @@
+package peerfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/benchmark"
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/Yashh56/go-peerfs/pkg/download"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/Yashh56/go-peerfs/pkg/link"
+	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+type SearchResult struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	FileHash string `json:"file_hash"`
+	PeerID   string `json:"peer_id"`
+	// IsDir marks a directory; FileHash is then its collection hash, to be
+	// downloaded with Collection.
+	IsDir bool `json:"is_dir,omitempty"`
+}
+
+type DownloadRequest struct {
+	Meta      file.FileMeta `json:"meta"`
+	Providers []string      `json:"providers"`
+	// Collection, if set, is the hash of a directory to download with all
+	// its files instead of Meta.
+	Collection string `json:"collection,omitempty"`
+	// Share optionally names a writable share to save the file into
+	// instead of the download directory.
+	Share string `json:"share,omitempty"`
+	// Priority is low, normal (the default) or high.
+	Priority download.Priority `json:"priority,omitempty"`
+}
+
+// PriorityRequest is the body of POST /downloads/{id}/priority. Priority
+// is required.
+type PriorityRequest struct {
+	Priority *download.Priority `json:"priority"`
+}
+
+func (n *Node) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", n.handleSearch)
+	mux.HandleFunc("GET /fileMeta", n.handleFileMeta)
+	mux.HandleFunc("POST /download", n.handleDownload)
+	mux.HandleFunc("GET /downloads", n.handleListJobs)
+	mux.HandleFunc("POST /downloads", n.handleAddJob)
+	mux.HandleFunc("GET /downloads/{id}", n.handleGetJob)
+	mux.HandleFunc("DELETE /downloads/{id}", n.handleCancelJob)
+	mux.HandleFunc("POST /downloads/{id}/pause", n.handlePauseJob)
+	mux.HandleFunc("POST /downloads/{id}/resume", n.handleResumeJob)
+	mux.HandleFunc("POST /downloads/{id}/priority", n.handleSetJobPriority)
+	mux.HandleFunc("GET /link", n.handleLink)
+	mux.HandleFunc("POST /get", n.handleGet)
+	mux.HandleFunc("POST /benchmark/transfer", n.handleBenchmarkTransfer)
+	mux.HandleFunc("POST /index", n.handleIndex)
+	mux.HandleFunc("GET /events", n.handleEvents)
+	mux.HandleFunc("GET /shares", n.handleListShares)
+	mux.HandleFunc("POST /shares", n.handleAddShare)
+	mux.HandleFunc("DELETE /shares/{name}", n.handleRemoveShare)
+	return mux
+}
+
+func (n *Node) handleSearch(w http.ResponseWriter, r *http.Request) {
+	queryValues := r.URL.Query()
+	query := queryValues.Get("q")
+	if query == "" {
+		http.Error(w, "Missing search query 'q'", http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("API: Received search query '%s'\n", query)
+
+	var allResults []SearchResult
+
+	localResults := n.Index.Search(query)
+	for _, meta := range localResults {
+		allResults = append(allResults, SearchResult{
+			Name:     meta.Name,
+			Size:     meta.Size,
+			FileHash: meta.FileHash,
+			PeerID:   n.Host.ID().String(), // Add our own ID
+			IsDir:    meta.IsDir,
+		})
+	}
+	peers := n.Host.Peerstore().Peers()
+	for _, p := range peers {
+		if p == n.Host.ID() {
+			continue
+		}
+		results, err := p2p.RequestSearch(r.Context(), n.Host, p, query)
+
+		if err != nil {
+			fmt.Printf("Error Searching Peer %s: %v\n", p, err)
+			continue
+		}
+		for _, meta := range results {
+			allResults = append(allResults, SearchResult{
+				Name:     meta.Name,
+				Size:     meta.Size,
+				FileHash: meta.FileHash,
+				PeerID:   p.String(),
+				IsDir:    meta.IsDir,
+			})
+		}
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(allResults)
+}
+
+// handleFileMeta returns the metadata of a file by hash. Files not in the
+// local index are looked up on the peers given as peer parameters, or on
+// the file's providers found in the DHT.
+func (n *Node) handleFileMeta(w http.ResponseWriter, r *http.Request) {
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		http.Error(w, "Missing file hash", http.StatusBadRequest)
+		return
+	}
+	peers, err := decodePeerIDs(r.URL.Query()["peer"])
+	if err != nil {
+		http.Error(w, "Invalid peer ID", http.StatusBadRequest)
+		return
+	}
+
+	meta, err := n.FileMeta(r.Context(), hash, peers)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("File metadata not found: %v", err), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(meta.Summary())
+}
+
+// handleDownload queues a download and waits for it to finish. The job
+// belongs to the daemon, so the transfer carries on if the client goes
+// away.
+func (n *Node) handleDownload(w http.ResponseWriter, r *http.Request) {
+	job, status, err := n.newJob(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if job, err = n.Jobs.Add(job); err != nil {
+		http.Error(w, fmt.Sprintf("Download failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	job, err = n.Jobs.Wait(r.Context(), job.ID)
+	if err != nil {
+		if errors.Is(err, download.ErrNoJob) {
+			http.Error(w, "Download was canceled", http.StatusConflict)
+		}
+		return
+	}
+	switch job.State {
+	case download.JobDone:
+		w.WriteHeader(http.StatusOK)
+		if job.Collection != "" {
+			fmt.Fprintf(w, "Download successful! Directory saved to %s", job.SavedTo)
+		} else {
+			fmt.Fprintf(w, "Download successful! File saved to %s", job.SavedTo)
+		}
+	case download.JobPaused:
+		http.Error(w, fmt.Sprintf("Download paused; resume it with 'go-peerfs jobs resume %s'", job.ID), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("Download failed: %s", job.Error), http.StatusInternalServerError)
+	}
+}
+
+// newJob builds a download job from a DownloadRequest body, returning the
+// HTTP status to reply with if the request is invalid.
+func (n *Node) newJob(r *http.Request) (download.Job, int, error) {
+	var req DownloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return download.Job{}, http.StatusBadRequest, errors.New("invalid request body")
+	}
+	providerIDs, err := decodePeerIDs(req.Providers)
+	if err != nil {
+		return download.Job{}, http.StatusBadRequest, errors.New("invalid peer ID")
+	}
+	if req.Collection == "" && req.Meta.FileHash == "" {
+		return download.Job{}, http.StatusBadRequest, errors.New("missing file metadata or collection")
+	}
+
+	saveDir := n.cfg.DownloadDir
+	if req.Share != "" {
+		state, ok := n.shareState(req.Share)
+		if !ok {
+			return download.Job{}, http.StatusBadRequest, errors.New("unknown share")
+		}
+		if state.cfg.ReadOnly {
+			return download.Job{}, http.StatusForbidden, errors.New("share is read-only")
+		}
+		saveDir = state.cfg.Path
+	}
+	if req.Collection != "" {
+		fmt.Printf("API: Received download request for collection %s\n", req.Collection)
+	} else {
+		fmt.Printf("API: Received download request for '%s'\n", req.Meta.Name)
+	}
+	return download.Job{
+		Meta:       req.Meta,
+		Collection: req.Collection,
+		Providers:  providerIDs,
+		SaveDir:    saveDir,
+		Priority:   req.Priority,
+	}, 0, nil
+}
+
+// handleAddJob queues a download and returns the job right away.
+func (n *Node) handleAddJob(w http.ResponseWriter, r *http.Request) {
+	job, status, err := n.newJob(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if job, err = n.Jobs.Add(job); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to queue download: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (n *Node) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(n.Jobs.Jobs())
+}
+
+func (n *Node) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := n.Jobs.Job(r.PathValue("id"))
+	if !ok {
+		http.Error(w, download.ErrNoJob.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (n *Node) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := n.Jobs.Cancel(id); err != nil {
+		jobError(w, err)
+		return
+	}
+	fmt.Fprintf(w, "Job %s canceled.", id)
+}
+
+func (n *Node) handlePauseJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := n.Jobs.Pause(id); err != nil {
+		jobError(w, err)
+		return
+	}
+	fmt.Fprintf(w, "Job %s paused.", id)
+}
+
+func (n *Node) handleResumeJob(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := n.Jobs.Resume(id); err != nil {
+		jobError(w, err)
+		return
+	}
+	fmt.Fprintf(w, "Job %s resumed.", id)
+}
+
+func (n *Node) handleSetJobPriority(w http.ResponseWriter, r *http.Request) {
+	var req PriorityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Priority == nil {
+		http.Error(w, "Missing priority", http.StatusBadRequest)
+		return
+	}
+	id := r.PathValue("id")
+	if err := n.Jobs.SetPriority(id, *req.Priority); err != nil {
+		jobError(w, err)
+		return
+	}
+	fmt.Fprintf(w, "Job %s priority set to %s.", id, *req.Priority)
+}
+
+func jobError(w http.ResponseWriter, err error) {
+	if errors.Is(err, download.ErrNoJob) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusConflict)
+}
+
+type LinkResponse struct {
+	URI string `json:"uri"`
+}
+
+type GetRequest struct {
+	URI      string            `json:"uri"`
+	Priority download.Priority `json:"priority"`
+}
+
+// handleLink returns a peerfs:// link for the file or directory given by
+// the target parameter, a path or a hash.
+func (n *Node) handleLink(w http.ResponseWriter, r *http.Request) {
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		http.Error(w, "Missing target", http.StatusBadRequest)
+		return
+	}
+	l, err := n.ShareLink(target)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(LinkResponse{URI: l.String()})
+}
+
+// handleGet queues a download of the file or directory a link points to
+// and, like POST /downloads, returns the job right away.
+func (n *Node) handleGet(w http.ResponseWriter, r *http.Request) {
+	var req GetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	l, err := link.Parse(req.URI)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid link: %v", err), http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("API: Received get request for %s\n", l.Hash)
+
+	job, err := n.LinkJob(r.Context(), l, n.cfg.DownloadDir)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to resolve link: %v", err), http.StatusBadGateway)
+		return
+	}
+	job.Priority = req.Priority
+	if job, err = n.Jobs.Add(job); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to queue download: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+func (n *Node) handleBenchmarkTransfer(w http.ResponseWriter, r *http.Request) {
+	var req DownloadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	providerIDs, err := decodePeerIDs(req.Providers)
+	if err != nil {
+		http.Error(w, "Invalid peer ID", http.StatusBadRequest)
+		return
+	}
+	// For a benchmark, we'll save to a temporary file.
+	savePath := filepath.Join(n.cfg.DownloadDir, "benchmark-"+req.Meta.Name)
+
+	startTime := time.Now()
+	err = n.Downloads.DownloadFile(r.Context(), req.Meta, providerIDs, savePath)
+	duration := time.Since(startTime)
+
+	logFile := n.cfg.Benchmark.LogFile
+	if err != nil {
+		msg := fmt.Sprintf("Download failed: %v", err)
+		benchmark.LogResult(logFile, "File Transfer", duration, "Result: FAILED - "+msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	// Calculate speed and log the successful result
+	fileSizeMB := float64(req.Meta.Size) / (1024 * 1024)
+	transferSpeed := fileSizeMB / duration.Seconds()
+	notes := fmt.Sprintf("File: %s, Size: %.2f MB, Speed: %.2f MB/s", req.Meta.Name, fileSizeMB, transferSpeed)
+	benchmark.LogResult(logFile, "File Transfer", duration, "Result: SUCCESS - "+notes)
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "Benchmark complete. Results logged to %s.\n%s", logFile, notes)
+}
+
+func (n *Node) handleIndex(w http.ResponseWriter, r *http.Request) {
+	rebuild := r.URL.Query().Get("rebuild") == "true"
+	fmt.Printf("API: Received index request (rebuild=%t)\n", rebuild)
+
+	if err := n.Reindex(rebuild); err != nil {
+		http.Error(w, fmt.Sprintf("Indexing failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "Indexing complete. Sharing %d files.", n.Index.Len())
+}
+
+func (n *Node) handleListShares(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-type", "application/json")
+	json.NewEncoder(w).Encode(n.Shares())
+}
+
+func (n *Node) handleAddShare(w http.ResponseWriter, r *http.Request) {
+	var sc config.ShareConfig
+	if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	fmt.Printf("API: Adding share '%s' (%s)\n", sc.Name, sc.Path)
+
+	if err := n.AddShare(sc); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to add share: %v", err), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, "Share '%s' added. Sharing %d files.", sc.Name, n.Index.Len())
+}
+
+func (n *Node) handleRemoveShare(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	fmt.Printf("API: Removing share '%s'\n", name)
+
+	if err := n.RemoveShare(name); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to remove share: %v", err), http.StatusBadRequest)
+		return
+	}
+	fmt.Fprintf(w, "Share '%s' removed.", name)
+}
+
+// handleEvents streams node events as Server-Sent Events. The optional
+// type parameter limits the stream to events whose type starts with it,
+// e.g. ?type=index. for index changes only.
+func (n *Node) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := n.Events.Subscribe(r.URL.Query().Get("type"))
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-n.ctx.Done():
+			return
+		case ev := <-events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+			flusher.Flush()
+		}
+	}
+}
+
+func decodePeerIDs(peerStrings []string) ([]peer.ID, error) {
+	var ids []peer.ID
+	for _, pStr := range peerStrings {
+		id, err := peer.Decode(pStr)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,98 @@
+package peerfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/blockstore"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+// blockGrace is how long a block no indexed file references is kept, so
+// recently downloaded chunks can still be reused.
+const blockGrace = 24 * time.Hour
+
+// blockCollectInterval is how often unreferenced blocks are collected
+// even if no file left the index.
+const blockCollectInterval = time.Hour
+
+// importBlocks queues the chunks of files to be copied into the block
+// store, if it is enabled. Only public files are imported.
+func (n *Node) importBlocks(files []file.FileMeta) {
+	if n.blocks == nil || len(files) == 0 {
+		return
+	}
+	n.blocksMu.Lock()
+	n.blockImports = append(n.blockImports, files...)
+	n.blocksMu.Unlock()
+	n.wakeBlocks()
+}
+
+// collectBlocks schedules the removal of blocks that no indexed file
+// references any more, once they are older than blockGrace.
+func (n *Node) collectBlocks() {
+	if n.blocks == nil {
+		return
+	}
+	n.blocksMu.Lock()
+	n.blockCollect = true
+	n.blocksMu.Unlock()
+	n.wakeBlocks()
+}
+
+func (n *Node) wakeBlocks() {
+	select {
+	case n.blocksWake <- struct{}{}:
+	default:
+	}
+}
+
+// runBlocks does the block store work queued by importBlocks and
+// collectBlocks until ctx is done, so indexing never waits for chunks to
+// be copied.
+func (n *Node) runBlocks(ctx context.Context) {
+	ticker := time.NewTicker(blockCollectInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.blocksWake:
+		case <-ticker.C:
+			n.collectBlocks()
+			continue
+		}
+
+		n.blocksMu.Lock()
+		files, collect := n.blockImports, n.blockCollect
+		n.blockImports, n.blockCollect = nil, false
+		n.blocksMu.Unlock()
+
+		for _, meta := range files {
+			if ctx.Err() != nil {
+				return
+			}
+			_, err := n.blocks.ImportFile(meta)
+			if errors.Is(err, blockstore.ErrFull) {
+				fmt.Printf("Block store is full (%d MiB), not copying in more shared files.\n", n.cfg.BlockStore.MaxSizeMiB)
+				break
+			}
+			if err != nil {
+				fmt.Printf("Failed to add %s to the block store: %v\n", meta.Path, err)
+			}
+		}
+		if collect {
+			deleted, err := n.blocks.Collect(func(hash string) bool {
+				_, _, ok := n.Index.LookupChunk(hash)
+				return ok
+			}, blockGrace)
+			if err != nil {
+				fmt.Printf("Failed to clean up the block store: %v\n", err)
+			} else if deleted > 0 {
+				fmt.Printf("Removed %d unused blocks from the block store.\n", deleted)
+			}
+		}
+	}
+}
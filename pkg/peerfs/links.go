@@ -0,0 +1,146 @@
+package peerfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/Yashh56/go-peerfs/pkg/download"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/Yashh56/go-peerfs/pkg/link"
+	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+)
+
+// ShareLink returns a link to a public file or directory of this node,
+// given by its path or hash, with this node's addresses as provider.
+func (n *Node) ShareLink(target string) (link.Link, error) {
+	meta, ok := n.findShared(target)
+	if !ok {
+		return link.Link{}, fmt.Errorf("%s is not shared by this node", target)
+	}
+	if !n.isPublic(meta.Share) {
+		return link.Link{}, fmt.Errorf("%s is in private share %s", target, meta.Share)
+	}
+	self := peer.AddrInfo{ID: n.Host.ID(), Addrs: p2p.AnnouncedAddrs(n.Host)}
+	return link.FromMeta(meta, []peer.AddrInfo{self}), nil
+}
+
+// findShared looks up an indexed file or directory by hash or by path,
+// preferring a public copy when the same content is also in a private
+// share.
+func (n *Node) findShared(target string) (file.FileMeta, bool) {
+	public := publicView{n}
+	if meta, ok := public.Lookup(target); ok {
+		return meta, true
+	}
+	if dir, _, ok := public.LookupCollection(target); ok {
+		return dir, true
+	}
+	if meta, ok := n.Index.Lookup(target); ok {
+		return meta, true
+	}
+	if dir, _, ok := n.Index.LookupCollection(target); ok {
+		return dir, true
+	}
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return file.FileMeta{}, false
+	}
+	for _, list := range [][]file.FileMeta{n.Index.Files(), n.Index.Dirs()} {
+		for _, meta := range list {
+			if p, err := filepath.Abs(meta.Path); err == nil && p == abs {
+				return meta, true
+			}
+		}
+	}
+	return file.FileMeta{}, false
+}
+
+// Get downloads the file or directory a link points to into saveDir and
+// returns where it was saved. The link's providers are connected to first;
+// for a link without any they are looked up by the download manager.
+func (n *Node) Get(ctx context.Context, l link.Link, saveDir string) (string, error) {
+	job, err := n.LinkJob(ctx, l, saveDir)
+	if err != nil {
+		return "", err
+	}
+	if job.Collection != "" {
+		return n.Downloads.DownloadCollection(ctx, job.Collection, job.Providers, saveDir)
+	}
+	name := filepath.Base(job.Meta.Name)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = job.Meta.FileHash
+	}
+	savePath := filepath.Join(saveDir, name)
+	return savePath, n.Downloads.DownloadFile(ctx, job.Meta, job.Providers, savePath)
+}
+
+// LinkJob resolves a link into a download job saving to saveDir, ready to
+// be queued: the link's providers are connected to, and the metadata of a
+// file is fetched if the link does not carry its Merkle root.
+func (n *Node) LinkJob(ctx context.Context, l link.Link, saveDir string) (download.Job, error) {
+	var providers []peer.ID
+	for _, info := range l.Providers {
+		if info.ID == n.Host.ID() {
+			providers = append(providers, info.ID)
+			continue
+		}
+		if err := n.Host.Connect(ctx, info); err != nil {
+			fmt.Printf("Could not connect to provider %s: %v\n", info.ID, err)
+			continue
+		}
+		// A queued job may only start later, so keep the link's addresses
+		// around longer than a plain connect does.
+		n.Host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.AddressTTL)
+		providers = append(providers, info.ID)
+	}
+	if len(l.Providers) > 0 && len(providers) == 0 {
+		return download.Job{}, errors.New("no provider of the link could be reached")
+	}
+
+	job := download.Job{Providers: providers, SaveDir: saveDir}
+	if l.Dir {
+		job.Collection = l.Hash
+		return job, nil
+	}
+	job.Meta = l.Meta()
+	if l.MerkleRoot == "" {
+		remote, err := n.FileMeta(ctx, l.Hash, providers)
+		if err != nil {
+			return download.Job{}, err
+		}
+		if l.Name != "" {
+			remote.Name = l.Name
+		}
+		job.Meta = remote.Summary()
+	}
+	return job, nil
+}
+
+// FileMeta returns the metadata of a file from the local index or, failing
+// that, from the first of peers, or of the providers found for it if peers
+// is empty, that sends valid metadata for it.
+func (n *Node) FileMeta(ctx context.Context, hash string, peers []peer.ID) (file.FileMeta, error) {
+	if meta, ok := n.Index.Lookup(hash); ok {
+		return meta, nil
+	}
+	if len(peers) == 0 {
+		peers = n.Downloads.FindProviders(ctx, hash)
+	}
+	lastErr := errors.New("no peer to ask")
+	for _, p := range peers {
+		if p == n.Host.ID() {
+			continue
+		}
+		meta, err := p2p.RequestMeta(ctx, n.Host, p, hash)
+		if err == nil {
+			return meta, nil
+		}
+		fmt.Printf("Metadata from %s rejected: %v\n", p, err)
+		lastErr = err
+	}
+	return file.FileMeta{}, lastErr
+}
@@ -0,0 +1,274 @@
+package peerfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/benchmark"
+	"github.com/Yashh56/go-peerfs/pkg/blockstore"
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/Yashh56/go-peerfs/pkg/download"
+	"github.com/Yashh56/go-peerfs/pkg/events"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Node is a single go-peerfs peer: its libp2p host, file index, discovery,
+// download manager and HTTP API. Several nodes can run in one process as
+// long as their configs use different data directories and API ports.
+type Node struct {
+	cfg *config.Config
+
+	Host      host.Host
+	Index     *file.Index
+	Downloads *download.DownloadManager
+	// Jobs runs the downloads requested through the API in the background.
+	Jobs *download.Queue
+	// Events carries index changes and other notifications for API clients.
+	Events *events.Bus
+
+	store     *file.Store
+	hasher    *file.Hasher
+	indexLock sync.Mutex
+	// blocks is nil unless the block store is enabled.
+	blocks *blockstore.Store
+	// blocksMu guards the work queued for runBlocks.
+	blocksMu     sync.Mutex
+	blockImports []file.FileMeta
+	blockCollect bool
+	blocksWake   chan struct{}
+
+	dht *dht.IpfsDHT
+	// provider is nil if the provide strategy is none.
+	provider *p2p.Provider
+	// announceMu guards the hashes queued for runAnnounce.
+	announceMu   sync.Mutex
+	announceKeys []string
+	announceWake chan struct{}
+
+	sharesMu sync.RWMutex
+	shares   map[string]*shareState
+
+	api    *http.Server
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(cfg *config.Config) (*Node, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return &Node{
+		cfg:    cfg,
+		Index:  file.NewIndex(nil),
+		Events: events.NewBus(),
+		shares: make(map[string]*shareState),
+
+		announceWake: make(chan struct{}, 1),
+		blocksWake:   make(chan struct{}, 1),
+	}, nil
+}
+
+func (n *Node) Config() *config.Config {
+	return n.cfg
+}
+
+func (n *Node) ID() peer.ID {
+	return n.Host.ID()
+}
+
+// Start brings the node online. It returns once the host, index and API
+// server are ready; discovery keeps running in the background until Close.
+func (n *Node) Start(ctx context.Context) error {
+	if err := os.MkdirAll(n.cfg.DataDir, 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	store, err := file.OpenStore(filepath.Join(n.cfg.DataDir, "index.db"))
+	if err != nil {
+		return err
+	}
+	n.store = store
+	n.hasher = file.NewHasher(n.cfg.Index.Workers, int64(n.cfg.Index.ReadLimitMiB)<<20)
+	if n.cfg.BlockStore.Enabled {
+		if n.blocks, err = blockstore.Open(filepath.Join(n.cfg.DataDir, "blocks")); err != nil {
+			n.store.Close()
+			return err
+		}
+		n.blocks.MaxSize = int64(n.cfg.BlockStore.MaxSizeMiB) << 20
+	}
+
+	priv, err := p2p.LoadOrCreateIdentity(n.cfg.DataDir)
+	if err != nil {
+		n.store.Close()
+		return fmt.Errorf("failed to load node identity: %w", err)
+	}
+	n.Host, err = p2p.Host(ctx, p2p.HostConfig{
+		PrivKey:     priv,
+		ListenAddrs: n.cfg.Network.Listen,
+		Announce:    n.cfg.Network.Announce,
+		NoAnnounce:  n.cfg.Network.NoAnnounce,
+	})
+	if err != nil {
+		n.store.Close()
+		return fmt.Errorf("failed to create host: %w", err)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	n.sharesMu.Lock()
+	n.ctx, n.cancel = runCtx, cancel
+	n.sharesMu.Unlock()
+	if n.dht, err = p2p.NewDHT(runCtx, n.Host); err != nil {
+		n.stopAll()
+		return err
+	}
+	if provide := n.cfg.Network.Provide; provide.Strategy != config.ProvideNone {
+		n.provider = p2p.NewProvider(n.dht, provide.Interval, n.provideKeys)
+	}
+	// Take the API port before any share is indexed or watched, so a port
+	// in use fails Start before anything is running.
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", n.cfg.API.Port))
+	if err != nil {
+		n.stopAll()
+		return fmt.Errorf("failed to start API server: %w", err)
+	}
+	n.cfg.API.Port = listener.Addr().(*net.TCPAddr).Port
+
+	fmt.Println("Starting file indexing...")
+	startTime := time.Now()
+	for _, sc := range n.cfg.Shares {
+		if err := n.startShare(sc, n.cfg.RebuildIndex); err != nil {
+			listener.Close()
+			n.stopAll()
+			return err
+		}
+	}
+	duration := time.Since(startTime)
+	benchmark.LogResult(n.cfg.Benchmark.LogFile, "File Indexing", duration, fmt.Sprintf("%d files indexed", n.Index.Len()))
+	fmt.Printf("File indexing completed in: %s\n", duration)
+	fmt.Printf("Sharing %d files.\n", n.Index.Len())
+
+	p2p.SetStreamHandler(n.Host, publicView{n})
+	p2p.SetSearchHandler(n.Host, publicView{n})
+	p2p.SetProofHandler(n.Host, publicView{n})
+	p2p.SetCollectionHandler(n.Host, publicView{n})
+	p2p.SetMetaHandler(n.Host, publicView{n})
+	p2p.SetHaveHandler(n.Host, publicView{n})
+	n.Downloads = download.NewDownloadManager(n.Host, n.Index, n.blocks, n.dht)
+	n.Downloads.Concurrency = n.cfg.Download.Concurrency
+	n.Downloads.PerPeer = n.cfg.Download.PerPeer
+	n.Downloads.StateDir = filepath.Join(n.cfg.DataDir, "downloads")
+	n.Downloads.OnProgress = func(p download.Progress) {
+		n.Events.Publish("download.progress", p)
+	}
+	if n.Jobs, err = download.NewQueue(n.Downloads, filepath.Join(n.cfg.DataDir, "jobs.json"), n.cfg.Download.Jobs); err != nil {
+		listener.Close()
+		n.stopAll()
+		return err
+	}
+	n.Jobs.OnChange = func(job download.Job) {
+		n.Events.Publish("download.job", job)
+	}
+
+	n.api = &http.Server{Handler: n.apiHandler()}
+
+	n.wg.Add(2)
+	go func() {
+		defer n.wg.Done()
+		if err := p2p.DiscoveryService(runCtx, n.Host, n.dht, n.cfg.Network.Rendezvous); err != nil {
+			fmt.Printf("Discovery stopped: %v\n", err)
+		}
+	}()
+	if n.provider != nil {
+		// The first round of Run covers everything indexed so far.
+		n.announceMu.Lock()
+		n.announceKeys = nil
+		n.announceMu.Unlock()
+		n.wg.Add(2)
+		go func() {
+			defer n.wg.Done()
+			n.provider.Run(runCtx)
+		}()
+		go func() {
+			defer n.wg.Done()
+			n.runAnnounce(runCtx)
+		}()
+	}
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.Jobs.Run(runCtx)
+	}()
+	if n.blocks != nil {
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.runBlocks(runCtx)
+		}()
+	}
+	go func() {
+		defer n.wg.Done()
+		fmt.Printf("API Server listening on http://localhost:%d\n", n.cfg.API.Port)
+		if err := n.api.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("API server stopped: %v\n", err)
+		}
+	}()
+
+	fmt.Printf("NODE ID: %s\n", n.Host.ID())
+	return nil
+}
+
+// Reindex rescans every share, hashing only new or changed files unless
+// rebuild is set, and swaps the results into the live index.
+func (n *Node) Reindex(rebuild bool) error {
+	for _, sc := range n.Shares() {
+		if err := n.reindexShare(sc, rebuild); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Sharing %d files.\n", n.Index.Len())
+	return nil
+}
+
+// Close stops the API server, watchers and discovery and shuts down the
+// host.
+func (n *Node) Close() error {
+	if !n.started() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	n.cancel()
+	apiErr := n.api.Shutdown(ctx)
+
+	return errors.Join(apiErr, n.stopAll())
+}
+
+// stopAll stops background work and releases the DHT, host and store; it
+// is also used to unwind a partially completed Start. Afterwards the node
+// counts as not started, so a later Close does nothing.
+func (n *Node) stopAll() error {
+	n.sharesMu.Lock()
+	n.cancel()
+	n.sharesMu.Unlock()
+	n.wg.Wait()
+	n.sharesMu.Lock()
+	n.ctx, n.cancel = nil, nil
+	n.sharesMu.Unlock()
+	var dhtErr error
+	if n.dht != nil {
+		dhtErr = n.dht.Close()
+	}
+	return errors.Join(dhtErr, n.Host.Close(), n.store.Close())
+}
@@ -0,0 +1,980 @@
+package peerfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/Yashh56/go-peerfs/pkg/download"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+	"github.com/Yashh56/go-peerfs/pkg/link"
+	"github.com/Yashh56/go-peerfs/pkg/p2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestNode(t *testing.T) *Node {
+	t.Helper()
+	root := t.TempDir()
+	cfg := config.Default(filepath.Join(root, "data"))
+	cfg.Shares[0].Path = filepath.Join(root, "shared")
+	cfg.DownloadDir = filepath.Join(root, "downloads")
+	cfg.API.Port = 0
+	cfg.Network.Listen = []string{"/ip4/127.0.0.1/tcp/0"}
+	cfg.Network.Rendezvous = "go-peerfs-test-" + t.Name()
+	cfg.Benchmark.LogFile = filepath.Join(root, "benchmarks.txt")
+
+	for _, dir := range []string{cfg.Shares[0].Path, cfg.DownloadDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	node, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestTwoNodesInOneProcess(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+
+	content := bytes.Repeat([]byte("go-peerfs "), 300000)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "data.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seeder.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	if err := leecher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer leecher.Close()
+
+	if seeder.ID() == leecher.ID() {
+		t.Fatal("Expected nodes to have distinct peer IDs")
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	files := seeder.Index.Files()
+	if len(files) != 1 {
+		t.Fatalf("Expected seeder to share 1 file, got %d", len(files))
+	}
+	savePath := filepath.Join(leecher.Config().DownloadDir, "data.bin")
+	if err := leecher.Downloads.DownloadFile(ctx, files[0].Summary(), []peer.ID{seeder.ID()}, savePath); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Downloaded file does not match the original")
+	}
+}
+
+func TestPrivateSharesAreHiddenFromPeers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "report-public.txt"), []byte("public"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	privateDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(privateDir, "report-private.txt"), []byte("private"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seeder.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	if err := leecher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer leecher.Close()
+
+	err := seeder.AddShare(config.ShareConfig{Name: "private", Path: privateDir, Visibility: config.VisibilityPrivate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(seeder.Index.Search("report")); got != 2 {
+		t.Fatalf("Expected both files in the local index, got %d", got)
+	}
+
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := p2p.RequestSearch(ctx, leecher.Host, seeder.ID(), "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Name != "report-public.txt" {
+		t.Errorf("Expected only the public file to be visible, got %+v", results)
+	}
+
+	if err := seeder.RemoveShare("private"); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(seeder.Index.Search("report")); got != 1 {
+		t.Errorf("Expected removed share to leave the index, got %d results", got)
+	}
+}
+
+func TestCDCDownloadReusesLocalChunks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	seeder.Config().Shares[0].Chunking = file.ChunkingCDC
+	leecher.Config().Shares[0].Chunking = file.ChunkingCDC
+
+	old := make([]byte, 8*1024*1024)
+	rand.New(rand.NewSource(42)).Read(old)
+	edited := append([]byte("a new header line\n"), old...)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "v2.bin"), edited, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(leecher.Config().Shares[0].Path, "v1.bin"), old, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seeder.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	if err := leecher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer leecher.Close()
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := seeder.Index.Files()[0]
+	reused := 0
+	for _, c := range meta.Chunks {
+		if _, _, ok := leecher.Index.LookupChunk(c.Hash); ok {
+			reused++
+		}
+	}
+	if reused < meta.NumChunks-2 {
+		t.Errorf("Expected most chunks to be available locally, %d of %d are", reused, meta.NumChunks)
+	}
+
+	savePath := filepath.Join(leecher.Config().DownloadDir, "v2.bin")
+	if err := leecher.Downloads.DownloadFile(ctx, meta.Summary(), []peer.ID{seeder.ID()}, savePath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, edited) {
+		t.Error("Downloaded file does not match the original")
+	}
+}
+
+func TestRecursiveDownload(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	shared := seeder.Config().Shares[0].Path
+	tree := map[string]string{
+		"album/cover.jpg":         "cover",
+		"album/disc1/track1.flac": "track one",
+		"album/disc1/track2.flac": "track two",
+		"album/disc2/track1.flac": "track one",
+		"album/disc2/empty.cue":   "",
+		"unrelated.txt":           "not in the album",
+	}
+	for rel, content := range tree {
+		path := filepath.Join(shared, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := seeder.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	if err := leecher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer leecher.Close()
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := p2p.RequestSearch(ctx, leecher.Host, seeder.ID(), "album")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !results[0].IsDir {
+		t.Fatalf("Expected the album directory, got %+v", results)
+	}
+
+	dir, err := leecher.Downloads.DownloadCollection(ctx, results[0].FileHash, []peer.ID{seeder.ID()}, leecher.Config().DownloadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, content := range tree {
+		if rel == "unrelated.txt" {
+			continue
+		}
+		got, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(rel[len("album/"):])))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q", rel, content, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unrelated.txt")); err == nil {
+		t.Error("File outside the directory was downloaded")
+	}
+}
+
+func TestGetByShareLink(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	path := filepath.Join(seeder.Config().Shares[0].Path, "notes.txt")
+	if err := os.WriteFile(path, []byte("shared by link"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := seeder.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	if err := leecher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer leecher.Close()
+
+	l, err := seeder.ShareLink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := link.Parse(l.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The leecher has never been connected to the seeder; the link's
+	// addresses are all it has.
+	saved, err := leecher.Get(ctx, parsed, leecher.Config().DownloadDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "shared by link" || filepath.Base(saved) != "notes.txt" {
+		t.Errorf("Unexpected download %s: %q", saved, got)
+	}
+}
+
+func TestDHTProviderRecords(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "provided.txt"), []byte("announced"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := seeder.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+	if err := leecher.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer leecher.Close()
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The seeder started with an empty routing table; its provider keeps
+	// retrying until the leecher is there to store the records.
+	hash := seeder.Index.Files()[0].FileHash
+	for {
+		providers, err := p2p.FindProviders(ctx, leecher.dht, hash, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(providers) > 0 {
+			if len(providers) != 1 || providers[0].ID != seeder.ID() {
+				t.Errorf("Expected the seeder as provider, got %+v", providers)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("The seeder's provider never announced its files")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func TestDownloadFindsProviders(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	bystander := newTestNode(t)
+	leecher := newTestNode(t)
+	content := bytes.Repeat([]byte("found without being told "), 100000)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "found.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, bystander, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	for _, n := range []*Node{seeder, bystander} {
+		if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: n.ID(), Addrs: n.Host.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	meta := seeder.Index.Files()[0]
+	providers := leecher.Downloads.FindProviders(ctx, meta.FileHash)
+	if len(providers) != 1 || providers[0] != seeder.ID() {
+		t.Errorf("Expected only the seeder as provider, got %v", providers)
+	}
+
+	savePath := filepath.Join(leecher.Config().DownloadDir, "found.bin")
+	if err := leecher.Downloads.DownloadFile(ctx, meta.Summary(), nil, savePath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Downloaded file does not match the original")
+	}
+}
+
+func TestDownloadFromSeveralProviders(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	first := newTestNode(t)
+	second := newTestNode(t)
+	leecher := newTestNode(t)
+	leecher.Config().Download.PerPeer = 1
+	content := make([]byte, 5*1024*1024+123)
+	rand.New(rand.NewSource(7)).Read(content)
+	for _, n := range []*Node{first, second} {
+		if err := os.WriteFile(filepath.Join(n.Config().Shares[0].Path, "both.bin"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []*Node{first, second, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	for _, n := range []*Node{first, second} {
+		if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: n.ID(), Addrs: n.Host.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var last download.Progress
+	leecher.Downloads.OnProgress = func(p download.Progress) {
+		if p.Finished {
+			last = p
+		}
+	}
+
+	meta := first.Index.Files()[0]
+	savePath := filepath.Join(leecher.Config().DownloadDir, "both.bin")
+	providers := []peer.ID{first.ID(), second.ID()}
+	if err := leecher.Downloads.DownloadFile(ctx, meta.Summary(), providers, savePath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Downloaded file does not match the original")
+	}
+
+	served := make(map[peer.ID]int)
+	for _, p := range last.Providers {
+		served[p.Peer] = p.Chunks
+	}
+	for _, id := range providers {
+		if served[id] < 1 {
+			t.Errorf("Expected every provider to serve at least one chunk, got %v", served)
+		}
+	}
+}
+
+func TestResumeDownload(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	leecher.Config().BlockStore.Enabled = true
+	content := make([]byte, 3*1024*1024)
+	rand.New(rand.NewSource(3)).Read(content)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "resume.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	// The seeder still answers metadata and proofs, but sends no chunks.
+	seeder.Host.RemoveStreamHandler(p2p.ChunkProtocol)
+	seeder.Host.RemoveStreamHandler(p2p.FileTransferProtocol)
+
+	// An earlier attempt wrote every chunk, but the first was damaged.
+	meta := seeder.Index.Files()[0]
+	savePath := filepath.Join(leecher.Config().DownloadDir, "resume.bin")
+	part := append([]byte{^content[0]}, content[1:]...)
+	if err := os.WriteFile(savePath+".part", part, 0644); err != nil {
+		t.Fatal(err)
+	}
+	done := bytes.Repeat([]byte{0xff}, (meta.NumChunks+7)/8)
+	state, err := json.Marshal(map[string]any{
+		"FileHash":   meta.FileHash,
+		"MerkleRoot": meta.MerkleRoot,
+		"Size":       meta.Size,
+		"NumChunks":  meta.NumChunks,
+		"Part":       savePath + ".part",
+		"Done":       done,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	statePath := filepath.Join(leecher.Config().DataDir, "downloads", file.NormalizeHash(meta.FileHash)+".state")
+	if err := os.MkdirAll(filepath.Dir(statePath), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(statePath, state, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	providers := []peer.ID{seeder.ID()}
+	attempt, stop := context.WithTimeout(ctx, 2*time.Second)
+	defer stop()
+	if err := leecher.Downloads.DownloadFile(attempt, meta.Summary(), providers, savePath); err == nil {
+		t.Fatal("Expected the damaged chunk to need the network")
+	}
+	if _, err := os.Stat(savePath + ".part"); err != nil {
+		t.Fatalf("Expected the partial download to be kept: %v", err)
+	}
+
+	first := meta.Chunks[0]
+	if err := leecher.blocks.Put(first.Hash, content[:first.Length]); err != nil {
+		t.Fatal(err)
+	}
+	if err := leecher.Downloads.DownloadFile(ctx, meta.Summary(), providers, savePath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Resumed file does not match the original")
+	}
+	for _, leftover := range []string{savePath + ".part", statePath} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed", leftover)
+		}
+	}
+}
+
+func TestDownloadFailsOverFromCorruptProvider(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	corrupt := newTestNode(t)
+	good := newTestNode(t)
+	leecher := newTestNode(t)
+	corrupt.Config().Watch.Enabled = false
+	content := make([]byte, 4*1024*1024)
+	rand.New(rand.NewSource(11)).Read(content)
+	for _, n := range []*Node{corrupt, good} {
+		if err := os.WriteFile(filepath.Join(n.Config().Shares[0].Path, "data.bin"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, n := range []*Node{corrupt, good, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	for _, n := range []*Node{corrupt, good} {
+		if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: n.ID(), Addrs: n.Host.Addrs()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The file changes on disk behind the unwatched index, so the corrupt
+	// node sends chunks that no longer match their hashes.
+	garbage := make([]byte, len(content))
+	rand.New(rand.NewSource(12)).Read(garbage)
+	if err := os.WriteFile(filepath.Join(corrupt.Config().Shares[0].Path, "data.bin"), garbage, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	meta := good.Index.Files()[0]
+	savePath := filepath.Join(leecher.Config().DownloadDir, "data.bin")
+	providers := []peer.ID{corrupt.ID(), good.ID()}
+	if err := leecher.Downloads.DownloadFile(ctx, meta.Summary(), providers, savePath); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(savePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Downloaded file does not match the original")
+	}
+}
+
+func TestDownloadJobs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	content := bytes.Repeat([]byte("queued "), 200000)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "queued.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(leecher.apiHandler())
+	defer api.Close()
+
+	body, err := json.Marshal(DownloadRequest{Meta: seeder.Index.Files()[0].Summary()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(api.URL+"/downloads", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job download.Job
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected the job to be accepted, got %s (%v)", resp.Status, err)
+	}
+
+	for job.State != download.JobDone {
+		if job.State == download.JobFailed {
+			t.Fatalf("Job failed: %s", job.Error)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("Job never finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+		resp, err := http.Get(api.URL + "/downloads/" + job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&job)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile(job.SavedTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("Downloaded file does not match the original")
+	}
+
+	for body, want := range map[string]int{`{"priority":"urgent"}`: http.StatusBadRequest, `{}`: http.StatusBadRequest, `{"priority":"high"}`: http.StatusOK} {
+		resp, err := http.Post(api.URL+"/downloads/"+job.ID+"/priority", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Expected %d setting %s, got %s", want, body, resp.Status)
+		}
+	}
+	if job, _ := leecher.Jobs.Job(job.ID); job.Priority != download.PriorityHigh {
+		t.Errorf("Expected the job priority to be high, got %s", job.Priority)
+	}
+	if resp, err := http.Get(api.URL + "/download"); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected GET /download to be refused, got %v", err)
+	} else {
+		resp.Body.Close()
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, api.URL+"/downloads/"+job.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = http.DefaultClient.Do(req); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := leecher.Jobs.Job(job.ID); ok || resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the job to be removed, got %s", resp.Status)
+	}
+}
+
+func TestDownloadProgressEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	content := bytes.Repeat([]byte("progress "), 300000)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "progress.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, unsubscribe := leecher.Events.Subscribe("download.progress")
+	defer unsubscribe()
+	job, err := leecher.Jobs.Add(download.Job{
+		Meta:      seeder.Index.Files()[0].Summary(),
+		Providers: []peer.ID{seeder.ID()},
+		SaveDir:   t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatal("Never saw the final progress report")
+		case ev := <-events:
+			p := ev.Data.(download.Progress)
+			if p.Job != job.ID {
+				t.Fatalf("Expected progress of job %s, got %q", job.ID, p.Job)
+			}
+			if !p.Finished {
+				continue
+			}
+			if p.Done != int64(len(content)) || p.ChunksDone != p.Chunks {
+				t.Fatalf("Expected %d bytes in %d chunks, got %d in %d", len(content), p.Chunks, p.Done, p.ChunksDone)
+			}
+			if len(p.Providers) != 1 || p.Providers[0].Peer != seeder.ID() || p.Providers[0].Bytes != p.Done {
+				t.Fatalf("Expected every byte to come from the seeder, got %+v", p.Providers)
+			}
+			return
+		}
+	}
+}
+
+func TestStartFailsWhenAPIPortIsTaken(t *testing.T) {
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	n := newTestNode(t)
+	n.Config().API.Port = taken.Addr().(*net.TCPAddr).Port
+	if err := os.WriteFile(filepath.Join(n.Config().Shares[0].Path, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Start(context.Background()); err == nil {
+		n.Close()
+		t.Fatal("Expected Start to fail while the API port is in use")
+	}
+	if n.Index.Len() != 0 || len(n.Shares()) != 1 || len(n.shares) != 0 {
+		t.Errorf("Expected no share to be indexed or watched, got %d files and %d running shares", n.Index.Len(), len(n.shares))
+	}
+	if err := n.Close(); err != nil {
+		t.Errorf("Expected Close after a failed Start to do nothing, got %v", err)
+	}
+}
+
+func TestPublicCopyOfPrivateContentIsServed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	seeder.Config().Shares[0].Visibility = config.VisibilityPrivate
+	publicDir := t.TempDir()
+	for _, dir := range []string{seeder.Config().Shares[0].Path, publicDir} {
+		if err := os.WriteFile(filepath.Join(dir, "same.txt"), []byte("same content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Added before Start, the share is indexed by Start after the private
+	// one, so the private copy comes first in the index.
+	if err := seeder.AddShare(config.ShareConfig{Name: "public", Path: publicDir}); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	files := seeder.Index.Files()
+	if len(files) != 2 || files[0].Share != "shared" {
+		t.Fatalf("Expected the private copy to be indexed first, got %+v", files)
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	has, err := p2p.RequestHave(ctx, leecher.Host, seeder.ID(), files[0].FileHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Error("Expected the public copy to be served despite the private one")
+	}
+}
+
+func TestChunkHashCannotEscapeBlockStore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	seeder.Config().BlockStore.Enabled = true
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The block store lives in <data>/blocks/<shard>/, so this would name
+	// the seeder's identity key.
+	data, err := p2p.RequestChunkByHash(ctx, leecher.Host, seeder.ID(), "../../identity.key")
+	if err == nil && len(data) > 0 {
+		t.Fatalf("Expected no data for a traversal hash, got %d bytes", len(data))
+	}
+}
+
+func TestBlocksOfPrivateFilesAreNotServed(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	seeder.Config().BlockStore.Enabled = true
+	seeder.Config().Shares[0].Visibility = config.VisibilityPrivate
+	content := []byte("private content")
+	path := filepath.Join(seeder.Config().Shares[0].Path, "private.txt")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	files := seeder.Index.Files()
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 indexed file, got %d", len(files))
+	}
+	// A block of the private file, as a download into the block store
+	// would leave it, must not be served even once the file is gone.
+	hash := files[0].Chunks[0].Hash
+	if err := seeder.blocks.Put(hash, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := p2p.RequestChunkByHash(ctx, leecher.Host, seeder.ID(), hash)
+	if err == nil && len(data) > 0 {
+		t.Fatalf("Expected the private block not to be served, got %q", data)
+	}
+}
+
+func TestShareLinkUsesAnnouncedAddrs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	seeder.Config().Network.Announce = []string{"/dns4/peer.example.com/tcp/4001"}
+	path := filepath.Join(seeder.Config().Shares[0].Path, "notes.txt")
+	if err := os.WriteFile(path, []byte("shared by link"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := seeder.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer seeder.Close()
+
+	l, err := seeder.ShareLink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Providers) != 1 || len(l.Providers[0].Addrs) != 1 || l.Providers[0].Addrs[0].String() != "/dns4/peer.example.com/tcp/4001" {
+		t.Errorf("Expected only the announced address in the link, got %+v", l.Providers)
+	}
+}
+
+func TestFileMetaFromPeer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	content := bytes.Repeat([]byte("go-peerfs "), 300000)
+	if err := os.WriteFile(filepath.Join(seeder.Config().Shares[0].Path, "data.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	if err := leecher.Host.Connect(ctx, peer.AddrInfo{ID: seeder.ID(), Addrs: seeder.Host.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	want := seeder.Index.Files()[0]
+
+	// The file hash and the Merkle root both name the file.
+	for _, hash := range []string{want.FileHash, want.MerkleRoot} {
+		meta, err := leecher.FileMeta(ctx, hash, []peer.ID{seeder.ID()})
+		if err != nil {
+			t.Fatalf("Failed to fetch metadata by %s: %v", hash, err)
+		}
+		if meta.FileHash != want.FileHash || meta.Size != want.Size || len(meta.Chunks) != len(want.Chunks) {
+			t.Errorf("Expected the seeder's metadata, got %+v", meta.Summary())
+		}
+		if meta.Path != "" || meta.Share != "" || meta.RelPath != "" {
+			t.Errorf("Expected no local paths in the metadata, got %q, %q and %q", meta.Path, meta.Share, meta.RelPath)
+		}
+	}
+	if _, err := leecher.FileMeta(ctx, strings.Repeat("0", 64), []peer.ID{seeder.ID()}); err == nil {
+		t.Error("Expected an error for a file the seeder does not have")
+	}
+}
+
+func TestGetQueuesJob(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	seeder := newTestNode(t)
+	leecher := newTestNode(t)
+	path := filepath.Join(seeder.Config().Shares[0].Path, "notes.txt")
+	if err := os.WriteFile(path, []byte("queued by link"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []*Node{seeder, leecher} {
+		if err := n.Start(ctx); err != nil {
+			t.Fatal(err)
+		}
+		defer n.Close()
+	}
+	l, err := seeder.ShareLink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(leecher.apiHandler())
+	defer api.Close()
+
+	body, err := json.Marshal(GetRequest{URI: l.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(api.URL+"/get", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job download.Job
+	err = json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("Expected the job to be accepted, got %s (%v)", resp.Status, err)
+	}
+
+	if job, err = leecher.Jobs.Wait(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job.State != download.JobDone {
+		t.Fatalf("Expected the job to be done, got %s: %s", job.State, job.Error)
+	}
+	got, err := os.ReadFile(job.SavedTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "queued by link" || filepath.Base(job.SavedTo) != "notes.txt" {
+		t.Errorf("Unexpected download %s: %q", job.SavedTo, got)
+	}
+}
@@ -0,0 +1,83 @@
+package peerfs
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+// provideKeys returns the hashes this node announces in the DHT, following
+// the configured strategy. Private shares are never announced.
+func (n *Node) provideKeys() []string {
+	var public []file.FileMeta
+	for _, meta := range n.Index.Files() {
+		if n.isPublic(meta.Share) {
+			public = append(public, meta)
+		}
+	}
+	keys := n.keysOf(public)
+	for _, dir := range n.Index.Dirs() {
+		if n.isPublic(dir.Share) {
+			keys = append(keys, dir.FileHash)
+		}
+	}
+	return keys
+}
+
+// keysOf returns the hashes to announce for files: their hashes, and with
+// the all strategy their chunk hashes too, each once.
+func (n *Node) keysOf(files []file.FileMeta) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	add := func(hash string) {
+		if !seen[hash] {
+			seen[hash] = true
+			keys = append(keys, hash)
+		}
+	}
+	for _, meta := range files {
+		add(meta.FileHash)
+		if n.cfg.Network.Provide.Strategy == config.ProvideAll {
+			for _, c := range meta.Chunks {
+				add(c.Hash)
+			}
+		}
+	}
+	return keys
+}
+
+// announce queues the hashes of newly indexed public files for
+// runAnnounce, instead of waiting for the next round of the provider.
+func (n *Node) announce(files []file.FileMeta) {
+	if n.provider == nil || len(files) == 0 {
+		return
+	}
+	keys := n.keysOf(files)
+	n.announceMu.Lock()
+	n.announceKeys = append(n.announceKeys, keys...)
+	n.announceMu.Unlock()
+	select {
+	case n.announceWake <- struct{}{}:
+	default:
+	}
+}
+
+// runAnnounce provides the hashes queued by announce until ctx is done.
+func (n *Node) runAnnounce(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.announceWake:
+		}
+		n.announceMu.Lock()
+		keys := n.announceKeys
+		n.announceKeys = nil
+		n.announceMu.Unlock()
+		if err := n.provider.Provide(ctx, keys); err != nil {
+			fmt.Printf("Failed to provide records: %v\n", err)
+		}
+	}
+}
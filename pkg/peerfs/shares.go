@@ -0,0 +1,321 @@
+package peerfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Yashh56/go-peerfs/pkg/config"
+	"github.com/Yashh56/go-peerfs/pkg/file"
+)
+
+type shareState struct {
+	cfg  config.ShareConfig
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// FileShare describes a configured share to the indexer, including the
+// node-wide exclude patterns of cfg.
+func FileShare(cfg *config.Config, sc config.ShareConfig) file.Share {
+	return file.Share{
+		Name:      sc.Name,
+		Root:      sc.Path,
+		Ignore:    cfg.Index.Exclude,
+		Include:   sc.Include,
+		Exclude:   sc.Exclude,
+		Chunking:  sc.Chunking,
+		ChunkSize: int64(sc.ChunkSizeKiB) << 10,
+		Hash:      cfg.Index.Hash,
+	}
+}
+
+// Shares returns the shares the node is currently serving.
+func (n *Node) Shares() []config.ShareConfig {
+	n.sharesMu.RLock()
+	defer n.sharesMu.RUnlock()
+	return slices.Clone(n.cfg.Shares)
+}
+
+// AddShare indexes and starts serving a new share, and records it in the
+// config file so it is still there after a restart. Called before Start,
+// it only records the share, which Start then indexes with the others.
+func (n *Node) AddShare(sc config.ShareConfig) error {
+	if sc.Visibility == "" {
+		sc.Visibility = config.VisibilityPublic
+	}
+	if err := sc.Validate(); err != nil {
+		return err
+	}
+	if slices.ContainsFunc(n.Shares(), func(s config.ShareConfig) bool { return s.Name == sc.Name }) {
+		return fmt.Errorf("share %q already exists", sc.Name)
+	}
+
+	if n.started() {
+		if err := n.startShare(sc, false); err != nil {
+			return err
+		}
+	}
+	n.sharesMu.Lock()
+	n.cfg.Shares = append(n.cfg.Shares, sc)
+	n.sharesMu.Unlock()
+
+	return config.UpdateFile(n.cfg.DataDir, func(c *config.Config) {
+		c.Shares = slices.DeleteFunc(c.Shares, func(s config.ShareConfig) bool { return s.Name == sc.Name })
+		c.Shares = append(c.Shares, sc)
+	})
+}
+
+// RemoveShare stops serving a share and forgets its indexed files. The
+// files on disk are left untouched.
+func (n *Node) RemoveShare(name string) error {
+	if !n.started() {
+		if !slices.ContainsFunc(n.Shares(), func(s config.ShareConfig) bool { return s.Name == name }) {
+			return fmt.Errorf("share %q does not exist", name)
+		}
+		n.sharesMu.Lock()
+		n.cfg.Shares = slices.DeleteFunc(n.cfg.Shares, func(s config.ShareConfig) bool { return s.Name == name })
+		n.sharesMu.Unlock()
+		return config.UpdateFile(n.cfg.DataDir, func(c *config.Config) {
+			c.Shares = slices.DeleteFunc(c.Shares, func(s config.ShareConfig) bool { return s.Name == name })
+		})
+	}
+	state, ok := n.shareState(name)
+	if !ok {
+		return fmt.Errorf("share %q does not exist", name)
+	}
+
+	n.sharesMu.Lock()
+	delete(n.shares, name)
+	n.cfg.Shares = slices.DeleteFunc(n.cfg.Shares, func(s config.ShareConfig) bool { return s.Name == name })
+	n.sharesMu.Unlock()
+
+	state.stop()
+	<-state.done
+
+	n.indexLock.Lock()
+	n.Index.RemoveShare(name)
+	err := n.store.Reset(state.cfg.Path)
+	n.indexLock.Unlock()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Stopped sharing %s (%s).\n", name, state.cfg.Path)
+	n.collectBlocks()
+
+	return config.UpdateFile(n.cfg.DataDir, func(c *config.Config) {
+		c.Shares = slices.DeleteFunc(c.Shares, func(s config.ShareConfig) bool { return s.Name == name })
+	})
+}
+
+// started reports whether Start has brought the node online; shares are
+// only indexed and watched from then on.
+func (n *Node) started() bool {
+	n.sharesMu.RLock()
+	defer n.sharesMu.RUnlock()
+	return n.ctx != nil
+}
+
+func (n *Node) shareState(name string) (*shareState, bool) {
+	n.sharesMu.RLock()
+	defer n.sharesMu.RUnlock()
+	state, ok := n.shares[name]
+	return state, ok
+}
+
+// startShare indexes a share and, if enabled, starts watching it.
+func (n *Node) startShare(sc config.ShareConfig, rebuild bool) error {
+	info, err := os.Stat(sc.Path)
+	if err != nil {
+		return fmt.Errorf("share %s: %w", sc.Name, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("share %s: %s is not a directory", sc.Name, sc.Path)
+	}
+
+	if err := n.reindexShare(sc, rebuild); err != nil {
+		return err
+	}
+
+	var watcher *file.Watcher
+	if n.cfg.Watch.Enabled {
+		watcher, err = file.NewWatcher(FileShare(n.cfg, sc), n.cfg.Watch.Debounce)
+		if err != nil {
+			n.Index.RemoveShare(sc.Name)
+			return err
+		}
+	}
+
+	ctx, stop := context.WithCancel(n.ctx)
+	state := &shareState{cfg: sc, stop: stop, done: make(chan struct{})}
+	// Close cancels n.ctx under sharesMu before waiting for n.wg, so no
+	// goroutine is added once it has started waiting.
+	n.sharesMu.Lock()
+	if n.ctx.Err() != nil {
+		n.sharesMu.Unlock()
+		stop()
+		if watcher != nil {
+			watcher.Close()
+		}
+		return fmt.Errorf("share %s: node is shutting down", sc.Name)
+	}
+	n.shares[sc.Name] = state
+	n.wg.Add(1)
+	n.sharesMu.Unlock()
+
+	go func() {
+		defer n.wg.Done()
+		defer close(state.done)
+		if watcher == nil {
+			<-ctx.Done()
+			return
+		}
+		fmt.Printf("Watching share %s (%s) for changes.\n", sc.Name, sc.Path)
+		share := FileShare(n.cfg, sc)
+		watcher.Run(ctx, func(path string) {
+			n.applyChange(share, path)
+		})
+	}()
+	return nil
+}
+
+func (n *Node) reindexShare(sc config.ShareConfig, rebuild bool) error {
+	n.indexLock.Lock()
+	defer n.indexLock.Unlock()
+
+	if rebuild {
+		fmt.Printf("Discarding stored index of share %s, every file will be re-hashed.\n", sc.Name)
+		if err := n.store.Reset(sc.Path); err != nil {
+			return fmt.Errorf("failed to reset index store: %w", err)
+		}
+	}
+	files, err := file.Reindex(FileShare(n.cfg, sc), n.store, n.hasher)
+	if err != nil {
+		return fmt.Errorf("failed to index share %s: %w", sc.Name, err)
+	}
+	n.Index.ReplaceShare(sc.Name, files)
+	n.collectBlocks()
+	if sc.Public() {
+		n.importBlocks(files)
+		n.announce(files)
+	}
+	return nil
+}
+
+// applyChange re-indexes a single path reported by a share's watcher and
+// publishes the resulting index events. A changed .peerfsignore can hide or
+// reveal any file below it, so it triggers a rescan of the whole share.
+func (n *Node) applyChange(share file.Share, path string) {
+	var changes []file.Change
+	var err error
+	n.indexLock.Lock()
+	if filepath.Base(path) == file.IgnoreFileName {
+		changes, err = n.rescanShare(share)
+	} else {
+		changes, err = file.UpdatePath(share, path, n.store, n.Index, n.hasher)
+	}
+	n.indexLock.Unlock()
+	if err != nil {
+		fmt.Printf("Failed to re-index %s: %v\n", path, err)
+		return
+	}
+	for _, c := range changes {
+		fmt.Printf("Index: %s %s\n", c.Type, c.Path)
+		n.Events.Publish("index."+string(c.Type), c)
+		if c.Type != file.ChangeAdded {
+			n.collectBlocks()
+		}
+		if c.Type != file.ChangeRemoved && n.isPublic(share.Name) {
+			n.importBlocks([]file.FileMeta{c.Meta})
+			n.announce([]file.FileMeta{c.Meta})
+		}
+	}
+}
+
+// rescanShare re-indexes a share and returns the files that entered or left
+// the index. The caller holds indexLock.
+func (n *Node) rescanShare(share file.Share) ([]file.Change, error) {
+	before := make(map[string]file.FileMeta)
+	for _, meta := range n.Index.Files() {
+		if meta.Share == share.Name {
+			before[meta.Path] = meta
+		}
+	}
+	files, err := file.Reindex(share, n.store, n.hasher)
+	if err != nil {
+		return nil, err
+	}
+	n.Index.ReplaceShare(share.Name, files)
+
+	var changes []file.Change
+	for _, meta := range files {
+		old, ok := before[meta.Path]
+		delete(before, meta.Path)
+		switch {
+		case !ok:
+			changes = append(changes, file.Change{Type: file.ChangeAdded, Path: meta.Path, Meta: meta})
+		case old.FileHash != meta.FileHash:
+			changes = append(changes, file.Change{Type: file.ChangeModified, Path: meta.Path, Meta: meta})
+		}
+	}
+	for _, meta := range before {
+		changes = append(changes, file.Change{Type: file.ChangeRemoved, Path: meta.Path, Meta: meta})
+	}
+	return changes, nil
+}
+
+func (n *Node) isPublic(shareName string) bool {
+	state, ok := n.shareState(shareName)
+	return ok && state.cfg.Public()
+}
+
+// publicView is the part of the index other peers may search and download
+// from: files in private shares are left out.
+type publicView struct {
+	n *Node
+}
+
+// visible reports whether meta is in a public share. The same content
+// can also be indexed in a private one, so lookups skip such copies rather
+// than stop at them.
+func (v publicView) visible(meta file.FileMeta) bool {
+	return v.n.isPublic(meta.Share)
+}
+
+func (v publicView) Lookup(hash string) (file.FileMeta, bool) {
+	return v.n.Index.LookupFunc(hash, v.visible)
+}
+
+func (v publicView) LookupChunk(hash string) (file.FileMeta, file.ChunkRecord, bool) {
+	return v.n.Index.LookupChunkFunc(hash, v.visible)
+}
+
+func (v publicView) LookupCollection(hash string) (file.FileMeta, file.Collection, bool) {
+	return v.n.Index.LookupCollectionFunc(hash, v.visible)
+}
+
+// Block serves a chunk from the block store only if a public file still
+// references it, so a block left over from a private or removed file is
+// never handed out.
+func (v publicView) Block(hash string) ([]byte, bool) {
+	if v.n.blocks == nil {
+		return nil, false
+	}
+	if _, _, ok := v.n.Index.LookupChunkFunc(hash, v.visible); !ok {
+		return nil, false
+	}
+	data, err := v.n.blocks.Get(hash)
+	return data, err == nil
+}
+
+func (v publicView) Search(query string) []file.FileMeta {
+	var results []file.FileMeta
+	for _, meta := range v.n.Index.Search(query) {
+		if v.n.isPublic(meta.Share) {
+			results = append(results, meta)
+		}
+	}
+	return results
+}